@@ -0,0 +1,227 @@
+package tinybox
+
+import (
+	"encoding/binary"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+)
+
+// The streams of attach frames. A frame is the stream byte, the big endian
+// uint32 length and the payload.
+const (
+	streamStdin  = 0
+	streamStdout = 1
+	streamStderr = 2
+	streamResize = 3 // payload is the rows and cols of terminal, two uint16
+
+	ringSize    = 64 * 1024 // bytes of recent output for late attachers
+	clientQueue = 256       // frames buffered for a client before dropping it
+)
+
+type frame struct {
+	stream byte
+	data   []byte
+}
+
+func writeFrame(w io.Writer, stream byte, data []byte) error {
+	var hdr [5]byte
+	hdr[0] = stream
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(data)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func readFrame(r io.Reader) (frame, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return frame{}, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(hdr[1:]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return frame{}, err
+	}
+	return frame{stream: hdr[0], data: data}, nil
+}
+
+// attachServer serves the stdio of a detached container on a unix socket,
+// the output is sent to all attached clients and the input of every client
+// goes to the container's stdin.
+type attachServer struct {
+	mu      sync.Mutex
+	ln      net.Listener
+	clients map[chan frame]struct{}
+	ring    []frame // recent output
+	size    int     // bytes in ring
+
+	stdin io.Writer
+	ptm   *os.File // the terminal to resize, nil without --tty
+}
+
+func newAttachServer(path string) (*attachServer, error) {
+	os.Remove(path)
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &attachServer{
+		ln:      ln,
+		clients: make(map[chan frame]struct{}),
+	}
+	go s.serve()
+
+	return s, nil
+}
+
+func (s *attachServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *attachServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	q := make(chan frame, clientQueue)
+
+	// Replay the latest frames, half of the queue is left for the new
+	// output, or the client is dropped as a slow one at once.
+	s.mu.Lock()
+	ring := s.ring
+	if n := clientQueue / 2; len(ring) > n {
+		ring = ring[len(ring)-n:]
+	}
+	for _, f := range ring {
+		q <- f
+	}
+	s.clients[q] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		s.input(conn)
+		s.remove(q)
+	}()
+
+	for f := range q {
+		if err := writeFrame(conn, f.stream, f.data); err != nil {
+			s.remove(q)
+			break
+		}
+	}
+}
+
+// input reads the stdin and resize frames of client.
+func (s *attachServer) input(conn net.Conn) {
+	for {
+		f, err := readFrame(conn)
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		stdin, ptm := s.stdin, s.ptm
+		s.mu.Unlock()
+
+		switch f.stream {
+		case streamStdin:
+			if stdin != nil {
+				stdin.Write(f.data)
+			}
+
+		case streamResize:
+			if ptm != nil && len(f.data) == 4 {
+				ws := winsize{
+					Row: binary.BigEndian.Uint16(f.data[0:]),
+					Col: binary.BigEndian.Uint16(f.data[2:]),
+				}
+				setWinsize(ptm.Fd(), &ws)
+			}
+		}
+	}
+}
+
+// setInput sets where the input of clients goes, ptm is the terminal of
+// container if it has.
+func (s *attachServer) setInput(stdin io.Writer, ptm *os.File) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stdin = stdin
+	s.ptm = ptm
+}
+
+func (s *attachServer) remove(q chan frame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.clients[q]; ok {
+		delete(s.clients, q)
+		close(q)
+	}
+}
+
+// broadcast sends the output to the clients and keeps it in the ring, a
+// client which can't keep up is dropped rather than blocking container.
+func (s *attachServer) broadcast(stream byte, p []byte) {
+	f := frame{stream: stream, data: append([]byte(nil), p...)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ring = append(s.ring, f)
+	s.size += len(f.data)
+	for s.size > ringSize && len(s.ring) > 1 {
+		s.size -= len(s.ring[0].data)
+		s.ring = s.ring[1:]
+	}
+
+	for q := range s.clients {
+		select {
+		case q <- f:
+		default:
+			log.Printf("Drop slow attach client \n")
+			delete(s.clients, q)
+			close(q)
+		}
+	}
+}
+
+// writer returns a writer of the output stream.
+func (s *attachServer) writer(stream byte) io.Writer {
+	return streamWriter{s, stream}
+}
+
+// Close stops accepting and disconnects all clients.
+func (s *attachServer) Close() error {
+	err := s.ln.Close()
+
+	s.mu.Lock()
+	for q := range s.clients {
+		delete(s.clients, q)
+		close(q)
+	}
+	s.mu.Unlock()
+
+	return err
+}
+
+type streamWriter struct {
+	s      *attachServer
+	stream byte
+}
+
+func (w streamWriter) Write(p []byte) (int, error) {
+	w.s.broadcast(w.stream, p)
+	return len(p), nil
+}
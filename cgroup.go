@@ -10,6 +10,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -22,6 +23,7 @@ const (
 	subsysFZ  = "freezer"
 	subsysBIO = "blkio"
 	subsysHT  = "hugetlb"
+	subsysPID = "pids"
 )
 
 var subs = []string{
@@ -33,6 +35,60 @@ var subs = []string{
 	subsysFZ,
 	subsysBIO,
 	subsysHT,
+	subsysPID,
+}
+
+// limitFiles are the cgroup files of the effective resource limits, in the
+// order the setters write them.
+var limitFiles = map[string][]string{
+	subsysCPU: {"cpu.shares", "cpu.cfs_period_us", "cpu.cfs_quota_us"},
+	subsysCS:  {"cpuset.cpus", "cpuset.mems"},
+	subsysMEM: {"memory.limit_in_bytes", "memory.soft_limit_in_bytes", "memory.memsw.limit_in_bytes"},
+}
+
+// limit is the value of a limit file.
+type limit struct {
+	file  string
+	value string
+}
+
+// readLimits reads the limit files of the cgroup paths, in the order of subs
+// and limitFiles, which is the order they're written in.
+func readLimits(paths map[string]string) []limit {
+	var limits []limit
+	for _, typ := range subs {
+		dir, ok := paths[typ]
+		if !ok {
+			continue
+		}
+		for _, file := range limitFiles[typ] {
+			name := filepath.Join(dir, file)
+			if b, err := ioutil.ReadFile(name); err == nil {
+				limits = append(limits, limit{name, string(bytes.TrimSpace(b))})
+			}
+		}
+	}
+	return limits
+}
+
+// restoreLimits writes back the limits read by readLimits in the reverse
+// order, since the kernel checks some limits against the others, like memsw
+// against the memory limit. Only the changed ones are written.
+func restoreLimits(limits []limit) error {
+	var errs []string
+	for i := len(limits) - 1; i >= 0; i-- {
+		name, v := limits[i].file, limits[i].value
+		if b, err := ioutil.ReadFile(name); err == nil && string(bytes.TrimSpace(b)) == v {
+			continue
+		}
+		if err := WriteFileStr(name, v); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
 }
 
 type CGroupOptions struct {
@@ -41,6 +97,7 @@ type CGroupOptions struct {
 	CpuCfsquota  string `json:"cpuquota"`
 	CpusetCpus   string `json:"cpusetcpus"`
 	CpusetMems   string `json:"cpusetmems"`
+	Memory       string `json:"memory"` // bytes, with k, m or g suffix
 }
 
 type CGroupSetter interface {
@@ -210,6 +267,64 @@ func (cg *CGroup) CpuAcct(c *Container) error {
 	return setters.Write(subsysCA, group, c.CgOpts)
 }
 
+// Freezer joins the freezer cgroup, it's skipped when the subsystem isn't
+// mounted, and the container can't be paused then.
+func (cg *CGroup) Freezer(c *Container) error {
+	if !cg.mounted(subsysFZ) {
+		return nil
+	}
+
+	group, err := cg.cgroupPath(subsysFZ, c)
+	if err != nil {
+		return err
+	}
+
+	if err := WriteFileInt(filepath.Join(group, "cgroup.procs"), c.Pid); err != nil {
+		return err
+	}
+
+	cg.paths[subsysFZ] = group
+	return setters.Write(subsysFZ, group, c.CgOpts)
+}
+
+// Pids joins the pids cgroup, it's skipped when the subsystem isn't mounted.
+func (cg *CGroup) Pids(c *Container) error {
+	if !cg.mounted(subsysPID) {
+		return nil
+	}
+
+	group, err := cg.cgroupPath(subsysPID, c)
+	if err != nil {
+		return err
+	}
+
+	if err := WriteFileInt(filepath.Join(group, "cgroup.procs"), c.Pid); err != nil {
+		return err
+	}
+
+	cg.paths[subsysPID] = group
+	return setters.Write(subsysPID, group, c.CgOpts)
+}
+
+// Blkio joins the blkio cgroup, it's skipped when the subsystem isn't mounted.
+func (cg *CGroup) Blkio(c *Container) error {
+	if !cg.mounted(subsysBIO) {
+		return nil
+	}
+
+	group, err := cg.cgroupPath(subsysBIO, c)
+	if err != nil {
+		return err
+	}
+
+	if err := WriteFileInt(filepath.Join(group, "cgroup.procs"), c.Pid); err != nil {
+		return err
+	}
+
+	cg.paths[subsysBIO] = group
+	return setters.Write(subsysBIO, group, c.CgOpts)
+}
+
 func (cg *CGroup) CpuSet(c *Container) error {
 	group, err := cg.cgroupPath(subsysCS, c)
 	if err != nil {
@@ -282,17 +397,13 @@ func (cg *CGroup) CpuSet(c *Container) error {
 }
 
 func (cg *CGroup) cgroupPath(name string, c *Container) (string, error) {
-	mount := cg.mounts[name]
-	root := cg.roots[name]
-
-	if mount == "" || root == "" {
-		return "", fmt.Errorf("Not found %s mount or root path", name)
+	path, err := cg.groupDir(name, c)
+	if err != nil {
+		return "", err
 	}
 
-	path := path.Join(mount, root, c.CgPrefix, c.Name)
-
 	if debug {
-		log.Printf("mount: %s, root: %s, prefix: %s, name: %s \n", mount, root, c.CgPrefix, c.Name)
+		log.Printf("mount: %s, root: %s, prefix: %s, name: %s \n", cg.mounts[name], cg.roots[name], c.CgPrefix, c.Name)
 	}
 
 	if err := os.MkdirAll(path, 0755); err != nil {
@@ -301,3 +412,75 @@ func (cg *CGroup) cgroupPath(name string, c *Container) (string, error) {
 
 	return path, nil
 }
+
+// mounted reports whether the subsystem is mounted and the root path of it is
+// known.
+func (cg *CGroup) mounted(name string) bool {
+	return cg.mounts[name] != "" && cg.roots[name] != ""
+}
+
+// groupDir returns the cgroup dir of container in the subsystem, it's not
+// created.
+func (cg *CGroup) groupDir(name string, c *Container) (string, error) {
+	if !cg.mounted(name) {
+		return "", fmt.Errorf("Not found %s mount or root path", name)
+	}
+
+	return path.Join(cg.mounts[name], cg.roots[name], c.CgPrefix, c.Name), nil
+}
+
+// lookup finds the existing cgroup dirs of container in all subsystems, it's
+// used by the commands which don't own the container.
+func (cg *CGroup) lookup(c *Container) {
+	for _, name := range subs {
+		dir, err := cg.groupDir(name, c)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(dir); err == nil {
+			cg.paths[name] = dir
+		}
+	}
+}
+
+// containerCgroups returns the existing cgroup dirs of container.
+func containerCgroups(c *Container) (map[string]string, error) {
+	cg, err := newCGroup()
+	if err != nil {
+		return nil, err
+	}
+	cg.lookup(c)
+	return cg.Paths(), nil
+}
+
+// joinCgroups moves the process into the cgroups of container.
+func joinCgroups(c *Container, pid int) error {
+	paths, err := containerCgroups(c)
+	if err != nil {
+		return err
+	}
+	for typ, dir := range paths {
+		if err := WriteFileInt(filepath.Join(dir, "cgroup.procs"), pid); err != nil {
+			return fmt.Errorf("Join %s cgroup error: %v", typ, err)
+		}
+	}
+	return nil
+}
+
+// CgroupProcs returns the pids in cgroup.procs of the cgroup dir.
+func CgroupProcs(dir string) ([]int, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, "cgroup.procs"))
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []int
+	for _, field := range strings.Fields(string(b)) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
@@ -0,0 +1,48 @@
+package tinybox
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+)
+
+const (
+	freezerFrozen = "FROZEN"
+	freezerThawed = "THAWED"
+)
+
+// freeze writes the state into freezer.state of the freezer cgroup dir, and
+// waits until the kernel finished freezing or thawing all the tasks.
+func freeze(dir string, state string) error {
+	if dir == "" {
+		return fmt.Errorf("Freezer cgroup is not available")
+	}
+
+	file := filepath.Join(dir, "freezer.state")
+	if err := WriteFileStr(file, state); err != nil {
+		return err
+	}
+
+	for i := 0; i < 1000; i++ {
+		cur, err := freezerState(dir)
+		if err != nil {
+			return err
+		}
+		if cur == state {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return fmt.Errorf("Wait freezer state %s timeout", state)
+}
+
+// freezerState reads the freezer.state of the freezer cgroup dir.
+func freezerState(dir string) (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, "freezer.state"))
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSpace(b)), nil
+}
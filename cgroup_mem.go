@@ -1,9 +1,21 @@
 package tinybox
 
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
 func init() {
 	registerSetter(&defaultMem{})
 }
 
+// memUnlimited is the memory limit which removes the limit, "0" leaves the
+// limit of the cgroup as it is.
+const memUnlimited = "-1"
+
 type defaultMem struct{}
 
 func (d defaultMem) IsSubsys(typ string) bool {
@@ -11,9 +23,48 @@ func (d defaultMem) IsSubsys(typ string) bool {
 }
 
 func (d defaultMem) Validate(opt *CGroupOptions) error {
-	return nil
+	if opt.Memory == "" || opt.Memory == memUnlimited {
+		return nil
+	}
+	_, err := ParseSize(opt.Memory)
+	return err
 }
 
 func (d defaultMem) Write(opt *CGroupOptions, dir string) error {
-	return nil
+	if opt.Memory == "" || opt.Memory == "0" {
+		return nil
+	}
+	if opt.Memory == memUnlimited {
+		return WriteFileStr(filepath.Join(dir, "memory.limit_in_bytes"), memUnlimited)
+	}
+
+	limit, err := ParseSize(opt.Memory)
+	if err != nil {
+		return err
+	}
+	return WriteFileStr(filepath.Join(dir, "memory.limit_in_bytes"), strconv.FormatInt(limit, 10))
+}
+
+// oomKillCount returns the oom_kill counter in memory.oom_control of the
+// memory cgroup dir, 0 if the kernel doesn't report it.
+func oomKillCount(dir string) int {
+	if dir == "" {
+		return 0
+	}
+
+	file, err := os.Open(filepath.Join(dir, "memory.oom_control"))
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			n, _ := strconv.Atoi(fields[1])
+			return n
+		}
+	}
+	return 0
 }
@@ -0,0 +1,97 @@
+package tinybox
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+)
+
+const (
+	efdCloexec  = 0x80000
+	efdNonblock = 0x800
+)
+
+// oomWatcher is notified by kernel when the memory cgroup runs out of memory,
+// through an eventfd registered in cgroup.event_control.
+type oomWatcher struct {
+	file *os.File // the eventfd
+	dir  string
+	n    uint64 // the events notified
+	fn   func(uint64)
+}
+
+// watchOOM watches the oom events of the memory cgroup dir, fn is called with
+// the number of new events in a goroutine.
+func watchOOM(dir string, fn func(uint64)) (*oomWatcher, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("Not joined the memory cgroup")
+	}
+
+	w := &oomWatcher{dir: dir, fn: fn}
+	if err := w.eventfd(); err != nil {
+		return nil, err
+	}
+	go w.readEventfd()
+	return w, nil
+}
+
+func (w *oomWatcher) eventfd() error {
+	fd, _, errno := syscall.RawSyscall(syscall.SYS_EVENTFD2, 0, efdCloexec|efdNonblock, 0)
+	if errno != 0 {
+		return fmt.Errorf("Eventfd error: %v", errno)
+	}
+	efd := os.NewFile(fd, "eventfd")
+
+	control, err := os.Open(filepath.Join(w.dir, "memory.oom_control"))
+	if err != nil {
+		efd.Close()
+		return err
+	}
+	defer control.Close()
+
+	v := fmt.Sprintf("%d %d", efd.Fd(), control.Fd())
+	if err := WriteFileStr(filepath.Join(w.dir, "cgroup.event_control"), v); err != nil {
+		efd.Close()
+		return err
+	}
+
+	w.file = efd
+	return nil
+}
+
+func (w *oomWatcher) readEventfd() {
+	buf := make([]byte, 8)
+	for {
+		if _, err := w.file.Read(buf); err != nil {
+			return
+		}
+		// The eventfd is notified too when the cgroup is removed.
+		if _, err := os.Stat(filepath.Join(w.dir, "cgroup.event_control")); err != nil {
+			return
+		}
+		w.notify(binary.LittleEndian.Uint64(buf))
+	}
+}
+
+func (w *oomWatcher) notify(n uint64) {
+	atomic.AddUint64(&w.n, n)
+	w.fn(n)
+}
+
+// count returns the oom events notified so far.
+func (w *oomWatcher) count() uint64 {
+	if w == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&w.n)
+}
+
+func (w *oomWatcher) Close() error {
+	if w == nil {
+		return nil
+	}
+	return w.file.Close()
+}
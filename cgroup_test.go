@@ -0,0 +1,126 @@
+package tinybox
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeCgroups creates the limit files of the subsystems in dir, and returns
+// the cgroup paths.
+func fakeCgroups(t *testing.T, dir string) map[string]string {
+	files := map[string]string{
+		"memory.limit_in_bytes":       "9223372036854771712",
+		"memory.soft_limit_in_bytes":  "9223372036854771712",
+		"memory.memsw.limit_in_bytes": "9223372036854771712",
+		"cpu.shares":                  "1024",
+		"cpu.cfs_period_us":           "100000",
+		"cpu.cfs_quota_us":            "-1",
+		"cpuset.cpus":                 "0-3",
+		"cpuset.mems":                 "0",
+	}
+
+	paths := make(map[string]string)
+	for _, typ := range []string{subsysMEM, subsysCPU, subsysCS} {
+		paths[typ] = filepath.Join(dir, typ)
+		if err := os.Mkdir(paths[typ], 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range limitFiles[typ] {
+			if err := WriteFileStr(filepath.Join(paths[typ], file), files[file]+"\n"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return paths
+}
+
+func TestReadLimits(t *testing.T) {
+	paths := fakeCgroups(t, t.TempDir())
+
+	var files []string
+	for _, l := range readLimits(paths) {
+		files = append(files, filepath.Base(l.file))
+	}
+	want := []string{
+		"memory.limit_in_bytes", "memory.soft_limit_in_bytes", "memory.memsw.limit_in_bytes",
+		"cpu.shares", "cpu.cfs_period_us", "cpu.cfs_quota_us",
+		"cpuset.cpus", "cpuset.mems",
+	}
+	if strings.Join(files, " ") != strings.Join(want, " ") {
+		t.Errorf("readLimits order = %v, want %v", files, want)
+	}
+}
+
+func TestRestoreLimitsReverse(t *testing.T) {
+	paths := fakeCgroups(t, t.TempDir())
+	limits := readLimits(paths)
+
+	// Every write fails, so the errors are in the order of the writes.
+	for _, l := range limits {
+		os.Remove(l.file)
+		if err := os.Mkdir(l.file, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := restoreLimits(limits)
+	if err == nil {
+		t.Fatal("restoreLimits succeeded")
+	}
+	last := len(err.Error())
+	for _, l := range limits {
+		i := strings.Index(err.Error(), l.file)
+		if i < 0 || i > last {
+			t.Fatalf("%s isn't written in the reverse order: %v", l.file, err)
+		}
+		last = i
+	}
+}
+
+func TestUpdateRollback(t *testing.T) {
+	dir := t.TempDir()
+	paths := fakeCgroups(t, dir)
+
+	// The last write fails.
+	mems := filepath.Join(paths[subsysCS], "cpuset.mems")
+	os.Remove(mems)
+	if err := os.Mkdir(mems, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	old := &CGroupOptions{CpuShares: "1024", CpuCfsPeriod: "100000", CpuCfsquota: "-1"}
+	c := &Container{Dir: dir, CgOpts: old, cgop: &CGroup{paths: paths}}
+	opt := &CGroupOptions{
+		CpuShares:    "512",
+		CpuCfsPeriod: "50000",
+		CpuCfsquota:  "25000",
+		CpusetCpus:   "1",
+		CpusetMems:   "1",
+		Memory:       "64m",
+	}
+	if err := (&masterProcess{}).update(c, opt); err == nil {
+		t.Fatal("update succeeded")
+	}
+
+	for typ, files := range map[string]map[string]string{
+		subsysMEM: {"memory.limit_in_bytes": "9223372036854771712"},
+		subsysCPU: {"cpu.shares": "1024", "cpu.cfs_period_us": "100000", "cpu.cfs_quota_us": "-1"},
+		subsysCS:  {"cpuset.cpus": "0-3"},
+	} {
+		for file, want := range files {
+			b, err := ioutil.ReadFile(filepath.Join(paths[typ], file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(string(b)); got != want {
+				t.Errorf("%s = %s after rollback, want %s", file, got, want)
+			}
+		}
+	}
+	if c.CgOpts != old {
+		t.Errorf("options changed by a failed update")
+	}
+}
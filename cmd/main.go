@@ -12,6 +12,13 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[0] != "init" && os.Args[0] != "setns" {
+		if ok, err := tinybox.RunCommand(os.Args[1], os.Args[2:]); ok {
+			exit(err)
+			return
+		}
+	}
+
 	c, err := tinybox.NewContainer()
 	if err != nil {
 		log.Fatalln(err)
@@ -34,7 +41,14 @@ func main() {
 	runtime.LockOSThread()
 	log.SetPrefix(typ + ": ")
 
-	if err := c.P.Start(c); err != nil {
+	exit(c.P.Start(c))
+}
+
+func exit(err error) {
+	if err != nil {
+		if e, ok := err.(*tinybox.ExitError); ok {
+			os.Exit(e.Code)
+		}
 		log.Fatalln(err)
 	}
 }
@@ -0,0 +1,68 @@
+package tinybox
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// command is a subcommand of tinybox, like `tinybox stop <name>`.
+type command struct {
+	name  string
+	usage string
+	run   func(fs *flag.FlagSet, args []string) error
+}
+
+var commands = make(map[string]*command)
+
+func registerCommand(cmd *command) {
+	commands[cmd.name] = cmd
+}
+
+// RunCommand runs the subcommand name with args, ok is false if there is
+// no such subcommand.
+func RunCommand(name string, args []string) (ok bool, err error) {
+	cmd, ok := commands[name]
+	if !ok {
+		return false, nil
+	}
+
+	// No subcommand takes a command after "--", it's a container named as
+	// the subcommand.
+	for _, arg := range args {
+		if arg == "--" {
+			return true, checkName(name)
+		}
+	}
+
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: tinybox %s %s\n", cmd.name, cmd.usage)
+		fs.PrintDefaults()
+	}
+
+	return true, cmd.run(fs, args)
+}
+
+// checkName rejects the container names which are the subcommands, they
+// can't be run or exec'd.
+func checkName(name string) error {
+	if name == "" {
+		return ErrOptInvalidName
+	}
+	if _, ok := commands[name]; ok {
+		return fmt.Errorf("Container's name %s is reserved for the subcommand", name)
+	}
+	return nil
+}
+
+// loadNamed parses the flags, and loads the container named by the only
+// argument.
+func loadNamed(fs *flag.FlagSet, args []string) (*Container, error) {
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return nil, ErrOptInvalid
+	}
+	return LoadContainer(fs.Arg(0))
+}
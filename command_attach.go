@@ -0,0 +1,191 @@
+package tinybox
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "attach",
+		usage: "[--detach-keys=ctrl-p,ctrl-q] <name>",
+		run:   attachCommand,
+	})
+}
+
+// attachCommand connects the stdio to a detached container, until the
+// container exits or the detach keys are typed.
+func attachCommand(fs *flag.FlagSet, args []string) error {
+	keys := fs.String("detach-keys", "ctrl-p,ctrl-q", "Key sequence for detaching from container")
+	c, err := loadNamed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	detachKeys, err := parseKeys(*keys)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.Dial("unix", c.AttachSocket())
+	if err != nil {
+		return fmt.Errorf("Container %s is not attachable: %v", c.Name, err)
+	}
+	defer conn.Close()
+
+	a := &attachClient{conn: conn}
+
+	if c.Tty {
+		if state, err := makeRaw(os.Stdin.Fd()); err == nil {
+			defer setTermios(os.Stdin.Fd(), state)
+		}
+
+		sc := make(chan os.Signal, 1)
+		signal.Notify(sc, syscall.SIGWINCH)
+		defer signal.Stop(sc)
+		go func() {
+			for range sc {
+				a.resize()
+			}
+		}()
+		a.resize()
+	}
+
+	exited := make(chan struct{})
+	detached := make(chan struct{})
+
+	go func() {
+		a.output()
+		close(exited)
+	}()
+	go func() {
+		if a.input(detachKeys) {
+			close(detached)
+		}
+	}()
+
+	select {
+	case <-detached:
+		fmt.Fprintf(os.Stderr, "\r\nDetached from %s\r\n", c.Name)
+		return nil
+	case <-exited:
+	}
+
+	// The monitor saved the exit state before closing the socket.
+	if c, err = LoadContainer(c.Name); err == nil && c.Exit != nil && c.Exit.Code != 0 {
+		return &ExitError{Code: c.Exit.Code}
+	}
+	return nil
+}
+
+type attachClient struct {
+	mu   sync.Mutex // serializes the frames to the monitor
+	conn net.Conn
+}
+
+func (a *attachClient) send(stream byte, data []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return writeFrame(a.conn, stream, data)
+}
+
+func (a *attachClient) resize() {
+	ws, err := getWinsize(os.Stdin.Fd())
+	if err != nil {
+		return
+	}
+
+	var data [4]byte
+	binary.BigEndian.PutUint16(data[0:], ws.Row)
+	binary.BigEndian.PutUint16(data[2:], ws.Col)
+	a.send(streamResize, data[:])
+}
+
+// output writes the frames of container to stdout and stderr.
+func (a *attachClient) output() {
+	for {
+		f, err := readFrame(a.conn)
+		if err != nil {
+			return
+		}
+
+		switch f.stream {
+		case streamStdout:
+			os.Stdout.Write(f.data)
+		case streamStderr:
+			os.Stderr.Write(f.data)
+		}
+	}
+}
+
+// input sends stdin to container, it returns true if the detach keys
+// are typed.
+func (a *attachClient) input(keys []byte) bool {
+	buf := make([]byte, 4096)
+	matched := 0
+
+	for {
+		n, err := os.Stdin.Read(buf)
+		if n > 0 {
+			var out []byte
+			for _, b := range buf[:n] {
+				if b == keys[matched] {
+					if matched++; matched == len(keys) {
+						return true
+					}
+					continue
+				}
+
+				// Not the detach keys, send the held keys.
+				out = append(out, keys[:matched]...)
+				matched = 0
+				if b == keys[0] {
+					matched = 1
+					continue
+				}
+				out = append(out, b)
+			}
+
+			if len(out) > 0 {
+				if err := a.send(streamStdin, out); err != nil {
+					return false
+				}
+			}
+		}
+		if err != nil {
+			return false
+		}
+	}
+}
+
+// parseKeys parses a key sequence like "ctrl-p,ctrl-q" or "a,b".
+func parseKeys(s string) ([]byte, error) {
+	var keys []byte
+	for _, key := range strings.Split(s, ",") {
+		key = strings.ToLower(strings.TrimSpace(key))
+
+		switch {
+		case len(key) == 1:
+			keys = append(keys, key[0])
+		case len(key) == 6 && strings.HasPrefix(key, "ctrl-") && key[5] >= 'a' && key[5] <= 'z':
+			keys = append(keys, key[5]-'a'+1)
+		case key == "ctrl-@":
+			keys = append(keys, 0)
+		case key == "ctrl-[":
+			keys = append(keys, 27)
+		default:
+			return nil, fmt.Errorf("Invalid detach key: %s", key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("Empty detach keys")
+	}
+	return keys, nil
+}
@@ -0,0 +1,97 @@
+package tinybox
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "stop",
+		usage: "<name>",
+		run:   stopCommand,
+	})
+	registerCommand(&command{
+		name:  "kill",
+		usage: "[-s SIGNAL] <name>",
+		run:   killCommand,
+	})
+	registerCommand(&command{
+		name:  "pause",
+		usage: "<name>",
+		run:   pauseCommand,
+	})
+	registerCommand(&command{
+		name:  "resume",
+		usage: "<name>",
+		run:   resumeCommand,
+	})
+}
+
+// stopCommand asks the master of container to stop it, and waits the
+// master to exit.
+func stopCommand(fs *flag.FlagSet, args []string) error {
+	c, err := loadNamed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if err := callControl(c, "Stop", &struct{}{}, &struct{}{}); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(time.Duration(c.StopTimeout+5) * time.Second)
+	for processAlive(c.MasterPid) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Wait container %s to stop timeout", c.Name)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	fmt.Println(c.Name)
+	return nil
+}
+
+// killCommand sends a signal to the init process of container.
+func killCommand(fs *flag.FlagSet, args []string) error {
+	sig := fs.String("s", "SIGKILL", "Signal to send to the container")
+	c, err := loadNamed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if err := callControl(c, "Kill", &KillArgs{Signal: *sig}, &struct{}{}); err != nil {
+		return err
+	}
+	fmt.Println(c.Name)
+	return nil
+}
+
+// pauseCommand freezes all processes of container.
+func pauseCommand(fs *flag.FlagSet, args []string) error {
+	c, err := loadNamed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if err := callControl(c, "Pause", &struct{}{}, &struct{}{}); err != nil {
+		return err
+	}
+	fmt.Println(c.Name)
+	return nil
+}
+
+// resumeCommand thaws all processes of a paused container.
+func resumeCommand(fs *flag.FlagSet, args []string) error {
+	c, err := loadNamed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if err := callControl(c, "Resume", &struct{}{}, &struct{}{}); err != nil {
+		return err
+	}
+	fmt.Println(c.Name)
+	return nil
+}
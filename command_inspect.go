@@ -0,0 +1,145 @@
+package tinybox
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "inspect",
+		usage: "[--format=TEMPLATE] <name>",
+		run:   inspectCommand,
+	})
+}
+
+// inspectInfo is the persisted container merged with its runtime state.
+type inspectInfo struct {
+	*Container
+
+	Status     string            `json:"status"`
+	CgPaths    map[string]string `json:"cgpaths"`
+	Namespaces map[string]uint64 `json:"namespaces,omitempty"` // inode numbers
+	Mounts     []mountInfo       `json:"mounts,omitempty"`
+	Processes  []*procNode       `json:"processes,omitempty"` // the process tree
+	Limits     map[string]string `json:"limits"`              // read back from the cgroup files
+}
+
+// procNode is a process of container and its children.
+type procNode struct {
+	Pid      int         `json:"pid"`
+	Ppid     int         `json:"ppid"`
+	Cmdline  []string    `json:"cmdline"`
+	Children []*procNode `json:"children,omitempty"`
+}
+
+// inspectCommand prints the json of container with its runtime state, or
+// executes the format template with it.
+func inspectCommand(fs *flag.FlagSet, args []string) error {
+	format := fs.String("format", "", "Format the output with a Go template")
+	c, err := loadNamed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	info := &inspectInfo{
+		Container: c,
+		Status:    c.Status(),
+		Limits:    make(map[string]string),
+	}
+
+	if info.Status == StatusRunning || info.Status == StatusPaused {
+		// The master has the latest state, like the updated cgroup options.
+		live := new(Container)
+		if err := callControl(c, "Info", &struct{}{}, live); err == nil {
+			info.Container = live
+		}
+
+		info.Namespaces, _ = procNamespaces(c.Pid)
+		info.Mounts, _ = procMounts(c.Pid)
+	}
+
+	if info.CgPaths, err = containerCgroups(c); err != nil {
+		return err
+	}
+
+	for subsys, files := range limitFiles {
+		dir := info.CgPaths[subsys]
+		if dir == "" {
+			continue
+		}
+		for _, file := range files {
+			if b, err := ioutil.ReadFile(filepath.Join(dir, file)); err == nil {
+				info.Limits[file] = string(bytes.TrimSpace(b))
+			}
+		}
+	}
+
+	if dir := info.CgPaths[subsysCA]; dir != "" {
+		if pids, err := CgroupProcs(dir); err == nil {
+			info.Processes = processTree(pids)
+		}
+	}
+
+	if *format != "" {
+		tmpl, err := template.New("inspect").Funcs(template.FuncMap{
+			"json": func(v interface{}) (string, error) {
+				b, err := json.Marshal(v)
+				return string(b), err
+			},
+			"join": strings.Join,
+		}).Parse(*format + "\n")
+		if err != nil {
+			return err
+		}
+		return tmpl.Execute(os.Stdout, info)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(info)
+}
+
+// processTree builds the tree of processes, the roots are the ones whose
+// parent isn't in pids.
+func processTree(pids []int) []*procNode {
+	nodes := make(map[int]*procNode, len(pids))
+	for _, pid := range pids {
+		ppid, err := procPpid(pid)
+		if err != nil {
+			continue
+		}
+		cmdline, _ := procCmdline(pid)
+		nodes[pid] = &procNode{Pid: pid, Ppid: ppid, Cmdline: cmdline}
+	}
+
+	var roots []*procNode
+	for _, pid := range pids {
+		node, ok := nodes[pid]
+		if !ok {
+			continue
+		}
+		if parent, ok := nodes[node.Ppid]; ok && parent != node {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	for _, node := range nodes {
+		sort.Slice(node.Children, func(i, j int) bool {
+			return node.Children[i].Pid < node.Children[j].Pid
+		})
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		return roots[i].Pid < roots[j].Pid
+	})
+	return roots
+}
@@ -0,0 +1,230 @@
+package tinybox
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "logs",
+		usage: "[--follow] [--since=10m] [--tail=N] <name>",
+		run:   logsCommand,
+	})
+}
+
+// logsCommand prints the captured output of container, from the oldest
+// rotated log file to the current one.
+func logsCommand(fs *flag.FlagSet, args []string) error {
+	var (
+		follow bool
+		since  string
+		tail   int
+	)
+	fs.BoolVar(&follow, "follow", false, "Follow the log output until container exits")
+	fs.BoolVar(&follow, "f", false, "Short of --follow")
+	fs.StringVar(&since, "since", "", "Show logs since a timestamp (RFC3339) or a duration like 10m")
+	fs.IntVar(&tail, "tail", -1, "Number of lines to show from the end of logs, -1 is all")
+	c, err := loadNamed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	p := &logPrinter{format: c.LogFormat}
+	if since != "" {
+		if c.LogFormat != logFormatJson {
+			return fmt.Errorf("--since needs the json log format")
+		}
+		if p.since, err = parseSince(since); err != nil {
+			return err
+		}
+	}
+
+	var files []string
+	for i := c.LogMaxFiles - 1; i > 0; i-- {
+		if _, err := os.Stat(rotatedLog(c.LogFile(), i)); err == nil {
+			files = append(files, rotatedLog(c.LogFile(), i))
+		}
+	}
+	files = append(files, c.LogFile())
+
+	var lines [][]byte
+	var offset int64
+	for _, name := range files {
+		n, err := readLines(name, 0, func(line []byte) {
+			if tail < 0 {
+				p.print(line)
+				return
+			}
+			if lines = append(lines, line); len(lines) > tail {
+				lines = lines[1:]
+			}
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		offset = n
+	}
+	for _, line := range lines {
+		p.print(line)
+	}
+
+	if follow {
+		return p.follow(c, offset)
+	}
+	return nil
+}
+
+// logPrinter prints the lines of log to stdout or stderr by their stream.
+type logPrinter struct {
+	format string
+	since  time.Time
+}
+
+func (p *logPrinter) print(line []byte) {
+	if p.format != logFormatJson {
+		os.Stdout.Write(line)
+		return
+	}
+
+	var entry logEntry
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return
+	}
+	if entry.Time.Before(p.since) {
+		return
+	}
+
+	if entry.Stream == "stderr" {
+		os.Stderr.WriteString(entry.Log)
+	} else {
+		os.Stdout.WriteString(entry.Log)
+	}
+}
+
+// follow prints the lines appended to the log from offset, until the master
+// of container exits. A rotation is noticed by the log file being replaced.
+func (p *logPrinter) follow(c *Container, offset int64) error {
+	var (
+		file    *os.File
+		br      *bufio.Reader
+		partial []byte
+	)
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	// drain prints the complete lines to the end of file.
+	drain := func() {
+		for {
+			line, err := br.ReadBytes('\n')
+			if partial = append(partial, line...); err != nil {
+				return
+			}
+			p.print(partial)
+			partial = nil
+		}
+	}
+
+	for {
+		alive := processAlive(c.MasterPid)
+
+		if file == nil {
+			var err error
+			if file, err = os.Open(c.LogFile()); err == nil {
+				file.Seek(offset, io.SeekStart)
+				br = bufio.NewReader(file)
+			} else if !os.IsNotExist(err) {
+				return err
+			}
+		}
+
+		if file != nil {
+			drain()
+
+			// Rotated, the new file is read from the beginning. The lines
+			// written into the old one after we read it are drained first,
+			// and the last line of it is complete even without the newline.
+			// The files rotated after it are read too.
+			fi, err := file.Stat()
+			if fi2, err2 := os.Stat(c.LogFile()); err == nil && err2 == nil && !os.SameFile(fi, fi2) {
+				drain()
+				if len(partial) > 0 {
+					p.print(partial)
+				}
+				for _, name := range rotatedAfter(c, fi) {
+					readLines(name, 0, p.print)
+				}
+				file.Close()
+				file, partial, offset = nil, nil, 0
+				continue
+			}
+		}
+
+		if !alive {
+			return nil
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// rotatedAfter returns the rotated logs which are newer than the rotated log
+// fi, the oldest first.
+func rotatedAfter(c *Container, fi os.FileInfo) []string {
+	for i := 1; i < c.LogMaxFiles; i++ {
+		fi2, err := os.Stat(rotatedLog(c.LogFile(), i))
+		if err != nil || !os.SameFile(fi, fi2) {
+			continue
+		}
+
+		var names []string
+		for j := i - 1; j > 0; j-- {
+			names = append(names, rotatedLog(c.LogFile(), j))
+		}
+		return names
+	}
+	return nil
+}
+
+// readLines calls fn for every complete line of the file from offset, and
+// returns the offset after the last complete line.
+func readLines(name string, offset int64, fn func([]byte)) (int64, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return offset, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+
+	br := bufio.NewReader(file)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil {
+			return offset, nil
+		}
+		offset += int64(len(line))
+		fn(line)
+	}
+}
+
+// parseSince parses a RFC3339 timestamp or a duration before now.
+func parseSince(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid since: %s", s)
+	}
+	return t, nil
+}
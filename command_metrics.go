@@ -0,0 +1,143 @@
+package tinybox
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "metrics",
+		usage: "[--listen=:9323]",
+		run:   metricsCommand,
+	})
+}
+
+// metricsCommand serves the metrics of containers in the Prometheus text
+// exposition format at /metrics, they are read at every scrape.
+func metricsCommand(fs *flag.FlagSet, args []string) error {
+	listen := fs.String("listen", ":9323", "Address to serve the metrics")
+	fs.Parse(args)
+
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		b, err := gatherMetrics()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(b)
+	})
+
+	log.Printf("Serve metrics on %s \n", *listen)
+	return http.ListenAndServe(*listen, nil)
+}
+
+// metric is a family of samples, they are written together after the HELP
+// and TYPE lines.
+type metric struct {
+	name    string
+	help    string
+	typ     string // gauge or counter
+	samples []string
+}
+
+func (m *metric) add(labels string, v float64) {
+	m.samples = append(m.samples, m.name+"{"+labels+"} "+strconv.FormatFloat(v, 'g', -1, 64))
+}
+
+// metricLabel formats a label pair, the value is escaped.
+func metricLabel(name, value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return name + `="` + value + `"`
+}
+
+func gatherMetrics() ([]byte, error) {
+	cs, err := Containers()
+	if err != nil {
+		return nil, err
+	}
+
+	newMetric := func(name, typ, help string) *metric {
+		return &metric{name: "tinybox_container_" + name, typ: typ, help: help}
+	}
+
+	var (
+		state         = newMetric("state", "gauge", "State of container, 1 for the current state.")
+		restarts      = newMetric("restarts_total", "counter", "Times the init process is restarted.")
+		cpuUsage      = newMetric("cpu_usage_seconds_total", "counter", "Cpu time consumed.")
+		cpuPeriods    = newMetric("cpu_periods_total", "counter", "Elapsed cfs periods.")
+		cpuThrottled  = newMetric("cpu_throttled_periods_total", "counter", "Throttled cfs periods.")
+		cpuThrottledT = newMetric("cpu_throttled_seconds_total", "counter", "Time throttled by cfs.")
+		memUsage      = newMetric("memory_usage_bytes", "gauge", "Memory usage.")
+		memLimit      = newMetric("memory_limit_bytes", "gauge", "Memory limit, absent if unlimited.")
+		memFailcnt    = newMetric("memory_failcnt_total", "counter", "Times the memory usage hit the limit.")
+		oomKills      = newMetric("oom_kills_total", "counter", "Processes killed by the oom killer.")
+		pids          = newMetric("pids", "gauge", "Number of tasks.")
+		ioReadBytes   = newMetric("io_read_bytes_total", "counter", "Bytes read from block devices.")
+		ioWriteBytes  = newMetric("io_write_bytes_total", "counter", "Bytes written to block devices.")
+		ioReadOps     = newMetric("io_read_ops_total", "counter", "Read operations on block devices.")
+		ioWriteOps    = newMetric("io_write_ops_total", "counter", "Write operations on block devices.")
+	)
+	metrics := []*metric{
+		state, restarts, cpuUsage, cpuPeriods, cpuThrottled, cpuThrottledT, memUsage, memLimit,
+		memFailcnt, oomKills, pids, ioReadBytes, ioWriteBytes, ioReadOps, ioWriteOps,
+	}
+
+	for _, c := range cs {
+		labels := metricLabel("name", c.Name) + "," + metricLabel("prefix", c.CgPrefix)
+
+		status := c.Status()
+		for _, s := range []string{StatusCreated, StatusRunning, StatusPaused, StatusRestarting, StatusExited} {
+			v := 0.0
+			if s == status {
+				v = 1
+			}
+			state.add(labels+","+metricLabel("state", s), v)
+		}
+		restarts.add(labels, float64(c.Restarts))
+
+		if status != StatusRunning && status != StatusPaused {
+			continue
+		}
+
+		paths, err := containerCgroups(c)
+		if err != nil {
+			return nil, err
+		}
+		s := readStats(paths)
+
+		cpuUsage.add(labels, float64(s.CpuUsage)/1e9)
+		cpuPeriods.add(labels, float64(s.CpuPeriods))
+		cpuThrottled.add(labels, float64(s.CpuThrottled))
+		cpuThrottledT.add(labels, float64(s.CpuThrottledTime)/1e9)
+		memUsage.add(labels, float64(s.MemoryUsage))
+		if s.MemoryLimit > 0 && s.MemoryLimit < unlimitedMemory {
+			memLimit.add(labels, float64(s.MemoryLimit))
+		}
+		memFailcnt.add(labels, float64(s.MemoryFailcnt))
+		oomKills.add(labels, float64(oomKillCount(paths[subsysMEM])))
+		pids.add(labels, float64(s.Pids))
+		ioReadBytes.add(labels, float64(s.IoReadBytes))
+		ioWriteBytes.add(labels, float64(s.IoWriteBytes))
+		ioReadOps.add(labels, float64(s.IoReadOps))
+		ioWriteOps.add(labels, float64(s.IoWriteOps))
+	}
+
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		if len(m.samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+		for _, sample := range m.samples {
+			buf.WriteString(sample + "\n")
+		}
+	}
+	return buf.Bytes(), nil
+}
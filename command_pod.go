@@ -0,0 +1,104 @@
+package tinybox
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "pod",
+		usage: "create [options] <pod> | rm <pod>",
+		run:   podCommand,
+	})
+}
+
+// podCommand creates or removes a pod.
+func podCommand(fs *flag.FlagSet, args []string) error {
+	if len(args) == 0 {
+		fs.Usage()
+		return ErrOptInvalid
+	}
+
+	switch args[0] {
+	case "create":
+		return podCreate(fs, args[1:])
+	case "rm":
+		return podRemove(fs, args[1:])
+	}
+	fs.Usage()
+	return ErrOptInvalid
+}
+
+// podCreate starts the infra container of pod in background, the pod level
+// options are passed to it.
+func podCreate(fs *flag.FlagSet, args []string) error {
+	fs.String("hostname", "", "Host name of the pod, default is its name")
+	fs.String("cpu-shares", "0", "")
+	fs.String("cpu-cfs-period", "0", "")
+	fs.String("cpu-cfs-quota", "0", "")
+	fs.String("cpuset-cpus", "", "")
+	fs.String("cpuset-mems", "", "")
+	fs.String("memory", "0", "Memory limit of the pod, like 512m")
+	fs.Bool("persist-ns", false, "Bind mount the namespace files of pod into its dir")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return ErrOptInvalid
+	}
+
+	name := fs.Arg(0)
+	if err := checkName(name); err != nil {
+		return err
+	}
+	if c, err := LoadContainer(name); err == nil {
+		return fmt.Errorf("Container %s exists, it's %s", name, c.Status())
+	}
+
+	infraArgs := []string{os.Args[0], name, "-d", "--pod-infra"}
+	fs.Visit(func(f *flag.Flag) {
+		infraArgs = append(infraArgs, fmt.Sprintf("--%s=%s", f.Name, f.Value))
+	})
+
+	cmd := &exec.Cmd{
+		Path:   "/proc/self/exe",
+		Args:   infraArgs,
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Create pod %s error: %v", name, err)
+	}
+	return nil
+}
+
+// podRemove kills and removes the members of pod, then its infra container.
+func podRemove(fs *flag.FlagSet, args []string) error {
+	infra, err := loadNamed(fs, args)
+	if err != nil {
+		return err
+	}
+	if !infra.Infra {
+		return fmt.Errorf("Container %s isn't a pod", infra.Name)
+	}
+
+	members, err := podMembers(infra.Name)
+	if err != nil {
+		return err
+	}
+	for _, c := range members {
+		if err := removeContainer(c, true); err != nil {
+			return fmt.Errorf("Remove member %s error: %v", c.Name, err)
+		}
+		fmt.Println(c.Name)
+	}
+
+	if err := removeContainer(infra, true); err != nil {
+		return err
+	}
+	fmt.Println(infra.Name)
+	return nil
+}
@@ -0,0 +1,139 @@
+package tinybox
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "ps",
+		usage: "[-a] [--format=table|json|TEMPLATE]",
+		run:   psCommand,
+	})
+}
+
+// psEntry is a line of ps, the fields could be used by the format template.
+type psEntry struct {
+	Name      string         `json:"name"`
+	Status    string         `json:"status"`
+	Health    string         `json:"health,omitempty"`
+	Command   string         `json:"command"`
+	Pid       int            `json:"pid"`
+	StartedAt time.Time      `json:"startedat"`
+	Uptime    string         `json:"uptime"`
+	CgOpts    *CGroupOptions `json:"cgopts"`
+}
+
+// psCommand lists the containers under TINYBOX_HOME, only the running,
+// paused and restarting ones without -a.
+func psCommand(fs *flag.FlagSet, args []string) error {
+	all := fs.Bool("a", false, "Show all containers, including the created and exited ones")
+	format := fs.String("format", "table", "Output format: table, json or a Go template")
+	fs.Parse(args)
+
+	cs, err := Containers()
+	if err != nil {
+		return err
+	}
+
+	var entries []*psEntry
+	for _, c := range cs {
+		e := &psEntry{
+			Name:    c.Name,
+			Status:  c.Status(),
+			Command: strings.Join(c.Argv, " "),
+			CgOpts:  c.CgOpts,
+		}
+		if !*all && e.Status != StatusRunning && e.Status != StatusPaused && e.Status != StatusRestarting {
+			continue
+		}
+		if e.Status == StatusRunning || e.Status == StatusPaused {
+			e.Pid = c.Pid
+			e.StartedAt = c.StartedAt
+			e.Uptime = time.Since(c.StartedAt).Truncate(time.Second).String()
+			if c.Health != nil {
+				e.Health = c.Health.Status
+			}
+		}
+		if e.CgOpts == nil {
+			e.CgOpts = &CGroupOptions{}
+		}
+		entries = append(entries, e)
+	}
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSTATUS\tCOMMAND\tPID\tUPTIME\tCPU\tMEMORY")
+		for _, e := range entries {
+			status := e.Status
+			if e.Health != "" {
+				status += " (" + e.Health + ")"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Name, status, truncate(e.Command, 30),
+				orDash(e.Pid), orDash(e.Uptime), cpuLimits(e.CgOpts), orDash(e.CgOpts.Memory))
+		}
+		return w.Flush()
+
+	default:
+		tmpl, err := template.New("ps").Parse(*format + "\n")
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := tmpl.Execute(os.Stdout, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// cpuLimits formats the cpu options which are set.
+func cpuLimits(opt *CGroupOptions) string {
+	var limits []string
+	if v := opt.CpuShares; v != "" && v != "0" {
+		limits = append(limits, "shares="+v)
+	}
+	if v := opt.CpuCfsquota; v != "" && v != "0" {
+		if p := opt.CpuCfsPeriod; p != "" && p != "0" {
+			v += "/" + p
+		}
+		limits = append(limits, "quota="+v)
+	}
+	if v := opt.CpusetCpus; v != "" {
+		limits = append(limits, "cpus="+v)
+	}
+	if len(limits) == 0 {
+		return "-"
+	}
+	return strings.Join(limits, ",")
+}
+
+// orDash formats a zero value as "-".
+func orDash(v interface{}) string {
+	switch v {
+	case 0, "", "0":
+		return "-"
+	}
+	return fmt.Sprint(v)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
@@ -0,0 +1,186 @@
+package tinybox
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "rm",
+		usage: "[-f] <name>",
+		run:   rmCommand,
+	})
+	registerCommand(&command{
+		name:  "gc",
+		usage: "",
+		run:   gcCommand,
+	})
+}
+
+// rmCommand removes a container, a running one is killed with -f.
+func rmCommand(fs *flag.FlagSet, args []string) error {
+	force := fs.Bool("f", false, "Kill the container if it's running")
+	c, err := loadNamed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if err := removeContainer(c, *force); err != nil {
+		return err
+	}
+	fmt.Println(c.Name)
+	return nil
+}
+
+// gcCommand removes all containers whose master and init process are gone,
+// the leftovers of crashed masters included.
+func gcCommand(fs *flag.FlagSet, args []string) error {
+	fs.Parse(args)
+
+	cs, err := Containers()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range cs {
+		// A master which is starting or cleaning up has no control socket
+		// to connect, but it's alive.
+		if c.masterAlive() || processAlive(c.MasterPid) || processStarted(c.Pid, c.StartTime) {
+			continue
+		}
+		if err := removeContainer(c, false); err != nil {
+			log.Printf("Remove container %s error: %v \n", c.Name, err)
+			continue
+		}
+		fmt.Println(c.Name)
+	}
+	return nil
+}
+
+// masterAlive reports whether the master of container is serving, a crashed
+// master leaves the control socket which can't be connected.
+func (c *Container) masterAlive() bool {
+	conn, err := net.DialTimeout("unix", c.ControlSocket(), time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// removeContainer kills the processes of container if force, unmounts the
+// leftover mounts, removes its cgroups and the container dir.
+func removeContainer(c *Container, force bool) error {
+	if c.Infra {
+		members, err := podMembers(c.Name)
+		if err != nil {
+			return err
+		}
+		if len(members) != 0 {
+			return fmt.Errorf("Pod %s has %d containers, remove it with pod rm", c.Name, len(members))
+		}
+	}
+
+	status := c.Status()
+	if status == StatusRunning || status == StatusPaused || status == StatusRestarting {
+		if !force {
+			return fmt.Errorf("Container %s is %s, stop it or remove it with -f", c.Name, status)
+		}
+		if c.masterAlive() {
+			if status == StatusPaused {
+				callControl(c, "Resume", &struct{}{}, &struct{}{})
+			}
+			// Stop first so the init process isn't restarted by the restart
+			// policy, and a pending restart is canceled.
+			callControl(c, "Stop", &struct{}{}, &struct{}{})
+			callControl(c, "Kill", &KillArgs{Signal: "SIGKILL"}, &struct{}{})
+		}
+	}
+
+	paths, err := containerCgroups(c)
+	if err != nil {
+		return err
+	}
+
+	// The master cleans up after the init process exits, wait it a moment.
+	for i := 0; i < 50 && c.masterAlive(); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if force {
+		killCgroups(paths)
+	}
+
+	if err := unmountUnder(c.Dir); err != nil {
+		return err
+	}
+	if c.Rootfs != "" {
+		if err := unmountUnder(filepath.Join(c.Rootfs, "proc")); err != nil {
+			return err
+		}
+	}
+
+	for _, dir := range paths {
+		if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Remove cgroup %s error: %v", dir, err)
+		}
+	}
+
+	return os.RemoveAll(c.Dir)
+}
+
+// killCgroups kills all processes in the cgroups, the frozen ones are thawed
+// so they could die.
+func killCgroups(paths map[string]string) {
+	if dir := paths[subsysFZ]; dir != "" {
+		freeze(dir, freezerThawed)
+	}
+
+	for i := 0; i < 50; i++ {
+		alive := false
+		for _, dir := range paths {
+			pids, _ := CgroupProcs(dir)
+			for _, pid := range pids {
+				syscall.Kill(pid, syscall.SIGKILL)
+				alive = true
+			}
+		}
+		if !alive {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// unmountUnder lazily unmounts the mounts at dir and under it in our mount
+// namespace, the deepest first.
+func unmountUnder(dir string) error {
+	mounts, err := procMounts(os.Getpid())
+	if err != nil {
+		return err
+	}
+
+	var points []string
+	for _, m := range mounts {
+		if m.MountPoint == dir || strings.HasPrefix(m.MountPoint, dir+"/") {
+			points = append(points, m.MountPoint)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(points)))
+
+	for _, point := range points {
+		if err := syscall.Unmount(point, syscall.MNT_DETACH); err != nil && err != syscall.EINVAL {
+			return fmt.Errorf("Unmount %s error: %v", point, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package tinybox
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "stats",
+		usage: "[--no-stream] [--format=table|json] [name...]",
+		run:   statsCommand,
+	})
+}
+
+// statsInterval is the interval of sampling, the cpu percent is computed
+// over it.
+const statsInterval = time.Second
+
+// unlimitedMemory is the memory.limit_in_bytes above which there's no limit,
+// its exact value depends on the page size.
+const unlimitedMemory = 1 << 62
+
+// statsEntry is the stats of a container with the rates over the interval.
+type statsEntry struct {
+	Name       string  `json:"name"`
+	CpuPercent float64 `json:"cpupercent"` // 100 is a whole cpu
+	*Stats
+}
+
+// statsCommand shows the resource usage of the named containers, or all the
+// running ones, refreshing every interval until interrupted.
+func statsCommand(fs *flag.FlagSet, args []string) error {
+	noStream := fs.Bool("no-stream", false, "Show the stats once and exit")
+	format := fs.String("format", "table", "Output format: table or json")
+	fs.Parse(args)
+
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("Invalid format: %s", *format)
+	}
+
+	last := make(map[string]*Stats)
+	for first := true; ; first = false {
+		cs, err := statsTargets(fs.Args())
+		if err != nil {
+			return err
+		}
+
+		var entries []*statsEntry
+		for _, c := range cs {
+			paths, err := containerCgroups(c)
+			if err != nil {
+				return err
+			}
+
+			e := &statsEntry{Name: c.Name, Stats: readStats(paths)}
+			if prev := last[c.Name]; prev != nil {
+				if d := e.Time.Sub(prev.Time); d > 0 && e.CpuUsage >= prev.CpuUsage {
+					e.CpuPercent = float64(e.CpuUsage-prev.CpuUsage) / float64(d) * 100
+				}
+			}
+			last[c.Name] = e.Stats
+			entries = append(entries, e)
+		}
+
+		// The cpu percent needs two samples.
+		if !first {
+			if err := printStats(entries, *format, !*noStream); err != nil {
+				return err
+			}
+			if *noStream {
+				return nil
+			}
+		}
+
+		time.Sleep(statsInterval)
+	}
+}
+
+// statsTargets loads the named containers, or all the containers without
+// names. Only the running and paused ones are returned.
+func statsTargets(names []string) ([]*Container, error) {
+	var cs []*Container
+	if len(names) == 0 {
+		var err error
+		if cs, err = Containers(); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, name := range names {
+			c, err := LoadContainer(name)
+			if err != nil {
+				return nil, err
+			}
+			cs = append(cs, c)
+		}
+	}
+
+	var running []*Container
+	for _, c := range cs {
+		if status := c.Status(); status == StatusRunning || status == StatusPaused {
+			running = append(running, c)
+		} else if len(names) != 0 {
+			log.Printf("Container %s is %s \n", c.Name, status)
+		}
+	}
+	return running, nil
+}
+
+// printStats prints the entries as a table or a json line, the screen is
+// cleared before the table if refresh.
+func printStats(entries []*statsEntry, format string, refresh bool) error {
+	if format == "json" {
+		if entries == nil {
+			entries = []*statsEntry{}
+		}
+		return json.NewEncoder(os.Stdout).Encode(entries)
+	}
+
+	if refresh {
+		fmt.Print("\033[2J\033[H")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tCPU %\tMEM USAGE / LIMIT\tMEM %\tPIDS\tBLOCK I/O\tTHROTTLED")
+	for _, e := range entries {
+		limit, percent := "-", "-"
+		if e.MemoryLimit > 0 && e.MemoryLimit < unlimitedMemory {
+			limit = FormatSize(e.MemoryLimit)
+			percent = fmt.Sprintf("%.2f%%", float64(e.MemoryUsage)/float64(e.MemoryLimit)*100)
+		}
+
+		throttled := "-"
+		if e.CpuPeriods > 0 {
+			throttled = fmt.Sprintf("%d/%d", e.CpuThrottled, e.CpuPeriods)
+		}
+
+		fmt.Fprintf(w, "%s\t%.2f%%\t%s / %s\t%s\t%d\t%s / %s\t%s\n", e.Name, e.CpuPercent,
+			FormatSize(e.MemoryUsage), limit, percent, e.Pids,
+			FormatSize(e.IoReadBytes), FormatSize(e.IoWriteBytes), throttled)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,79 @@
+package tinybox
+
+import (
+	"flag"
+	"fmt"
+)
+
+func init() {
+	registerCommand(&command{
+		name:  "update",
+		usage: "[--cpu-shares=N] [--cpu-cfs-period=N] [--cpu-cfs-quota=N] [--cpuset-cpus=LIST] [--cpuset-mems=LIST] [--memory=SIZE] <name>",
+		run:   updateCommand,
+	})
+}
+
+// updateCommand changes the cgroup options of a running container, the
+// options not given are kept. A 0 option isn't written by the master, so it's
+// changed into the value which removes the limit.
+func updateCommand(fs *flag.FlagSet, args []string) error {
+	var set CGroupOptions
+	fs.StringVar(&set.CpuShares, "cpu-shares", "", "CPU shares, 0 is the default 1024")
+	fs.StringVar(&set.CpuCfsPeriod, "cpu-cfs-period", "", "CPU CFS period in microseconds, 0 is the default 100000")
+	fs.StringVar(&set.CpuCfsquota, "cpu-cfs-quota", "", "CPU CFS quota in microseconds, 0 or -1 is unlimited")
+	fs.StringVar(&set.CpusetCpus, "cpuset-cpus", "", "CPUs allowed, like 0-2,4")
+	fs.StringVar(&set.CpusetMems, "cpuset-mems", "", "Memory nodes allowed")
+	fs.StringVar(&set.Memory, "memory", "", "Memory limit, like 512m, 0 is unlimited")
+	c, err := loadNamed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	// The master has the latest options.
+	live := new(Container)
+	if err := callControl(c, "Info", &struct{}{}, live); err != nil {
+		return err
+	}
+
+	opt := CGroupOptions{}
+	if live.CgOpts != nil {
+		opt = *live.CgOpts
+	}
+
+	n := 0
+	fs.Visit(func(f *flag.Flag) {
+		n++
+		switch f.Name {
+		case "cpu-shares":
+			opt.CpuShares = zeroTo(set.CpuShares, "1024")
+		case "cpu-cfs-period":
+			opt.CpuCfsPeriod = zeroTo(set.CpuCfsPeriod, "100000")
+		case "cpu-cfs-quota":
+			opt.CpuCfsquota = zeroTo(set.CpuCfsquota, "-1")
+		case "cpuset-cpus":
+			opt.CpusetCpus = set.CpusetCpus
+		case "cpuset-mems":
+			opt.CpusetMems = set.CpusetMems
+		case "memory":
+			opt.Memory = zeroTo(set.Memory, memUnlimited)
+		}
+	})
+	if n == 0 {
+		return fmt.Errorf("Nothing to update")
+	}
+
+	reply := new(CGroupOptions)
+	if err := callControl(c, "Update", &opt, reply); err != nil {
+		return err
+	}
+	fmt.Println(c.Name)
+	return nil
+}
+
+// zeroTo returns def if the option is 0.
+func zeroTo(v, def string) string {
+	if v == "0" {
+		return def
+	}
+	return v
+}
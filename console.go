@@ -0,0 +1,250 @@
+package tinybox
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// newPty creates a pseudo-terminal pair from the ptmx device, the pts is
+// opened from the devpts directory where the ptmx is.
+func newPty(ptmx string) (ptm *os.File, pts *os.File, err error) {
+	ptm, err = os.OpenFile(ptmx, os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			ptm.Close()
+		}
+	}()
+
+	var unlock int32
+	if err = ioctl(ptm.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		return nil, nil, fmt.Errorf("Unlock pty error: %v", err)
+	}
+
+	var n uint32
+	if err = ioctl(ptm.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); err != nil {
+		return nil, nil, fmt.Errorf("Get pty number error: %v", err)
+	}
+
+	dir := filepath.Dir(ptmx)
+	if filepath.Base(dir) != "pts" {
+		dir = filepath.Join(dir, "pts")
+	}
+
+	pts, err = os.OpenFile(filepath.Join(dir, strconv.Itoa(int(n))), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ptm, pts, nil
+}
+
+// openConsole is shared by the init and setns processes, the ptmx of the
+// container's devpts is used if it exists.
+func openConsole(sock *os.File) error {
+	ptmx := "/dev/pts/ptmx"
+	if _, err := os.Stat(ptmx); err != nil {
+		ptmx = "/dev/ptmx"
+	}
+
+	ptm, pts, err := newPty(ptmx)
+	if err != nil {
+		return err
+	}
+
+	err = sendFd(sock, ptm)
+	ptm.Close()
+	if err != nil {
+		return fmt.Errorf("Send console error: %v", err)
+	}
+
+	return setCtty(pts)
+}
+
+// setCtty makes pts the controlling terminal and the stdio of the current
+// process, the process becomes a session leader.
+func setCtty(pts *os.File) error {
+	if _, err := syscall.Setsid(); err != nil {
+		return fmt.Errorf("setsid error: %v", err)
+	}
+	if err := ioctl(pts.Fd(), syscall.TIOCSCTTY, 0); err != nil {
+		return fmt.Errorf("Set controlling terminal error: %v", err)
+	}
+	for fd := 0; fd < 3; fd++ {
+		if err := syscall.Dup3(int(pts.Fd()), fd, 0); err != nil {
+			return err
+		}
+	}
+	return pts.Close()
+}
+
+// sendFd sends the file through the unix socket.
+func sendFd(sock *os.File, f *os.File) error {
+	rights := syscall.UnixRights(int(f.Fd()))
+	return syscall.Sendmsg(int(sock.Fd()), []byte(f.Name()), rights, nil, 0)
+}
+
+// recvFd receives a file sent by sendFd from the unix socket.
+func recvFd(sock *os.File) (*os.File, error) {
+	name := make([]byte, 256)
+	oob := make([]byte, syscall.CmsgSpace(4))
+
+	n, oobn, _, _, err := syscall.Recvmsg(int(sock.Fd()), name, oob, 0)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 && oobn == 0 {
+		return nil, io.EOF
+	}
+
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) != 1 {
+		return nil, fmt.Errorf("Receive %d control messages, expect 1", len(msgs))
+	}
+
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(fds) != 1 {
+		return nil, fmt.Errorf("Receive %d fds, expect 1", len(fds))
+	}
+
+	syscall.CloseOnExec(fds[0])
+	return os.NewFile(uintptr(fds[0]), string(name[:n])), nil
+}
+
+// console is the master side of the container's terminal, it proxies the
+// stdio of tinybox and puts the host terminal into raw mode.
+type console struct {
+	ptm   *os.File
+	state *syscall.Termios // saved host terminal, nil if stdin isn't a tty
+	sc    chan os.Signal
+	done  chan struct{}
+}
+
+func newConsole(ptm *os.File) *console {
+	cs := &console{
+		ptm:  ptm,
+		sc:   make(chan os.Signal, 1),
+		done: make(chan struct{}),
+	}
+
+	if state, err := makeRaw(os.Stdin.Fd()); err == nil {
+		cs.state = state
+	}
+
+	cs.resize()
+	signal.Notify(cs.sc, syscall.SIGWINCH)
+	go func() {
+		for range cs.sc {
+			cs.resize()
+		}
+	}()
+
+	return cs
+}
+
+// proxy copies in to the terminal and the terminal's output to out, in is
+// nil if the input is written to the terminal by others.
+func (cs *console) proxy(in io.Reader, out io.Writer) {
+	if in != nil {
+		go io.Copy(cs.ptm, in)
+	}
+	go func() {
+		io.Copy(out, cs.ptm)
+		close(cs.done)
+	}()
+}
+
+// resize sets the window size of the host terminal to the container's.
+func (cs *console) resize() {
+	ws, err := getWinsize(os.Stdin.Fd())
+	if err != nil {
+		return
+	}
+	if err := setWinsize(cs.ptm.Fd(), ws); err != nil {
+		log.Printf("Resize console error: %v \n", err)
+	}
+}
+
+// Close waits a moment for the rest output, then restores the host terminal.
+func (cs *console) Close() error {
+	select {
+	case <-cs.done:
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	signal.Stop(cs.sc)
+	close(cs.sc)
+
+	if cs.state != nil {
+		setTermios(os.Stdin.Fd(), cs.state)
+	}
+	return cs.ptm.Close()
+}
+
+type winsize struct {
+	Row    uint16
+	Col    uint16
+	Xpixel uint16
+	Ypixel uint16
+}
+
+func getWinsize(fd uintptr) (*winsize, error) {
+	ws := new(winsize)
+	if err := ioctl(fd, syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(ws))); err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
+
+func setWinsize(fd uintptr, ws *winsize) error {
+	return ioctl(fd, syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(ws)))
+}
+
+// makeRaw puts the terminal into raw mode, and returns the previous state.
+func makeRaw(fd uintptr) (*syscall.Termios, error) {
+	var old syscall.Termios
+	if err := ioctl(fd, syscall.TCGETS, uintptr(unsafe.Pointer(&old))); err != nil {
+		return nil, err
+	}
+
+	raw := old
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+
+	if err := setTermios(fd, &raw); err != nil {
+		return nil, err
+	}
+	return &old, nil
+}
+
+func setTermios(fd uintptr, t *syscall.Termios) error {
+	return ioctl(fd, syscall.TCSETS, uintptr(unsafe.Pointer(t)))
+}
+
+func ioctl(fd, req, arg uintptr) error {
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg); e != 0 {
+		return e
+	}
+	return nil
+}
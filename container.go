@@ -4,14 +4,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"os"
 	"path"
 	"path/filepath"
 	"syscall"
+	"time"
 )
 
 type namespaceOper interface {
 	Cloneflags(*Container) uintptr
+	Join(*Container) error
 	Setup(*Container) error
 }
 
@@ -22,6 +25,9 @@ type cgroupOper interface {
 	CPU(*Container) error
 	CpuAcct(*Container) error
 	CpuSet(*Container) error
+	Freezer(*Container) error
+	Pids(*Container) error
+	Blkio(*Container) error
 }
 
 type rootfsOper interface {
@@ -34,21 +40,79 @@ type Container struct {
 	Name string `json:"name"` // container's name
 	Dir  string `json:"dir"`
 
-	Rootfs   string         `json:"rootfs"`
-	Path     string         `json:"path"` // the binary path of the first process.
-	Argv     []string       `json:"argv"`
-	Hostname string         `json:"hostname"`
-	CgPrefix string         `json:"cgprefix"`
-	CgOpts   *CGroupOptions `json:"cgopts"`
-
-	Pid int `json:"pid"` // process id of the init process
+	Rootfs      string            `json:"rootfs"`
+	Path        string            `json:"path"` // the binary path of the first process.
+	Argv        []string          `json:"argv"`
+	Hostname    string            `json:"hostname"`
+	JoinNs      map[string]string `json:"joinns,omitempty"`      // namespace type to the container joined
+	Pod         string            `json:"pod"`                   // the pod which container is in
+	Infra       bool              `json:"infra"`                 // the infra container of a pod
+	PersistNs   bool              `json:"persistns"`             // bind mount the namespace files into the dir
+	TimeOffsets *TimeOffsets      `json:"timeoffsets,omitempty"` // the clocks of time namespace
+	CgPrefix    string            `json:"cgprefix"`
+	CgOpts      *CGroupOptions    `json:"cgopts"`
+	Init        bool              `json:"init"` // keep tinybox as pid 1 and fork the command
+	Tty         bool              `json:"tty"`
+
+	StopSignal  string `json:"stopsignal"`
+	StopTimeout int    `json:"stoptimeout"` // seconds before SIGKILL when stopping
+	Restart     string `json:"restart"`     // the restart policy
+	Detach      bool   `json:"detach"`
+	Hooks       *Hooks `json:"hooks,omitempty"`
+
+	Healthcheck *HealthConfig `json:"healthcheck,omitempty"`
+	Health      *HealthState  `json:"health,omitempty"`
+
+	LogFormat   string `json:"logformat"`   // plain or json
+	LogMaxSize  int64  `json:"logmaxsize"`  // bytes, 0 is unlimited
+	LogMaxFiles int    `json:"logmaxfiles"` // files kept by rotation
+
+	Pid       int        `json:"pid"`       // process id of the init process
+	MasterPid int        `json:"masterpid"` // process id of the master (monitor) process
+	StartTime uint64     `json:"starttime"` // start time of init process, in clock ticks
+	StartedAt time.Time  `json:"startedat"`
+	Exit      *ExitState `json:"exit,omitempty"`
+	LastExit  *ExitState `json:"lastexit,omitempty"` // the exit before the last restart
+	Restarts  int        `json:"restarts"`           // times the init process is restarted
+	OOMEvents int        `json:"oomevents"`          // out of memory events of the memory cgroup
+
+	// Restarting is set by the master in the reply of Info only, when it
+	// waits to restart the init process.
+	Restarting bool `json:"restarting,omitempty"`
 
 	nsop   namespaceOper `json:"-"`
 	cgop   cgroupOper    `json:"-"`
 	fsop   rootfsOper    `json:"-"`
 	P      process       `json:"-"`
 	isExec bool          `json:"-"`
+	exec   *execConfig   `json:"-"` // the command and options of --exec
+	stdin  bool          `json:"-"` // keep stdin open for --exec
 	typ    string        `json:"-"`
+
+	cmdline []string // the original command line of tinybox
+}
+
+// The status of container.
+const (
+	StatusCreated    = "created"
+	StatusRunning    = "running"
+	StatusPaused     = "paused"
+	StatusRestarting = "restarting"
+	StatusExited     = "exited"
+)
+
+// TimeOffsets are the offsets of the clocks in the time namespace of container.
+type TimeOffsets struct {
+	Monotonic time.Duration `json:"monotonic"`
+	Boottime  time.Duration `json:"boottime"`
+}
+
+// ExitState is how the init process of container exited.
+type ExitState struct {
+	Code       int       `json:"code"` // exit code, 128+signal if killed
+	Signal     string    `json:"signal,omitempty"`
+	OOMKilled  bool      `json:"oomkilled"`
+	FinishedAt time.Time `json:"finishedat"`
 }
 
 func NewContainer() (*Container, error) {
@@ -57,9 +121,9 @@ func NewContainer() (*Container, error) {
 		return nil, err
 	}
 
-	home := os.Getenv("TINYBOX_HOME")
-	if !path.IsAbs(home) {
-		return nil, fmt.Errorf("Not found TINYBOX_HOME environment var")
+	home, err := Home()
+	if err != nil {
+		return nil, err
 	}
 
 	c := new(Container)
@@ -99,22 +163,112 @@ func NewContainer() (*Container, error) {
 			return nil, err
 		}
 
-		c.Path = opt.argv
-		c.Argv = nil
+		c.setArgv(opt.argv)
+		c.Tty = opt.tty
+		c.Detach = opt.detach
 		c.Hostname = ""
 		c.Rootfs = ""
+		c.stdin = opt.interactive
+		c.exec = &execConfig{
+			Args:    opt.argv,
+			Tty:     opt.tty,
+			Env:     opt.execEnv,
+			User:    opt.execUser,
+			Workdir: opt.execWorkdir,
+		}
 
 		return c, nil
 	}
 
 	c.Rootfs = opt.root
-	c.Path = opt.argv
-	c.Argv = opt.args
+	c.setArgv(opt.argv)
 	c.Hostname = opt.hostname
+	c.JoinNs = opt.joinNs
+	c.Infra = opt.podInfra
+	c.PersistNs = opt.persistNs
+	if opt.timeMonotonic != 0 || opt.timeBoottime != 0 {
+		c.TimeOffsets = &TimeOffsets{Monotonic: opt.timeMonotonic, Boottime: opt.timeBoottime}
+	}
+	if c.Pod = opt.pod; c.Pod != "" {
+		pod, err := LoadContainer(c.Pod)
+		if err != nil {
+			return nil, err
+		}
+		if !pod.Infra {
+			return nil, fmt.Errorf("Container %s isn't a pod", c.Pod)
+		}
+		c.CgPrefix = podCgPrefix(c.Pod)
+	}
+	c.Init = opt.init
+	c.Tty = opt.tty
+	c.StopSignal = opt.stopSig
+	c.StopTimeout = opt.stopTime
+	c.Restart = opt.restart
+	c.Hooks = opt.hooks
+	c.Detach = opt.detach
+	c.LogFormat = opt.logFormat
+	c.LogMaxSize = opt.logMaxSize
+	c.LogMaxFiles = opt.logMaxFiles
+	c.cmdline = opt.cmdline
+
+	if opt.healthArgv != nil {
+		c.Healthcheck = &HealthConfig{
+			Argv:        opt.healthArgv,
+			Interval:    opt.healthInterval,
+			Timeout:     opt.healthTimeout,
+			Retries:     opt.healthRetries,
+			StartPeriod: opt.healthStartPeriod,
+			OnUnhealthy: opt.healthOnUnhealthy,
+		}
+		c.Health = &HealthState{Status: healthStarting}
+	}
 
 	return c, nil
 }
 
+// Home returns the TINYBOX_HOME dir, where the containers are.
+func Home() (string, error) {
+	home := os.Getenv("TINYBOX_HOME")
+	if !path.IsAbs(home) {
+		return "", fmt.Errorf("Not found TINYBOX_HOME environment var")
+	}
+	return home, nil
+}
+
+// LoadContainer reads the container.json of the named container.
+func LoadContainer(name string) (*Container, error) {
+	home, err := Home()
+	if err != nil {
+		return nil, err
+	}
+
+	c := new(Container)
+	c.Dir = filepath.Join(home, name)
+
+	info, err := ioutil.ReadFile(c.JsonFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("No such container: %s", name)
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(info, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// setArgv sets the command of the container, the init and setns processes
+// have no command line, they get it from the master.
+func (c *Container) setArgv(argv []string) {
+	c.Argv = argv
+	if len(argv) > 0 {
+		c.Path = argv[0]
+	} else {
+		c.Path = ""
+	}
+}
+
 func (c *Container) SetByType(typ string) error {
 	c.typ = typ
 
@@ -144,6 +298,63 @@ func (c *Container) SetByType(typ string) error {
 	return nil
 }
 
+// Status checks the status of a loaded container, the init process is alive
+// if its pid has the same start time.
+func (c *Container) Status() string {
+	if c.Pid == 0 {
+		return StatusCreated
+	}
+	if c.Exit != nil || !processStarted(c.Pid, c.StartTime) {
+		// Only the master knows whether it waits to restart the init
+		// process, or it's cleaning up after the last exit.
+		if c.Exit != nil && c.masterRestarting() {
+			return StatusRestarting
+		}
+		return StatusExited
+	}
+
+	if paths, err := containerCgroups(c); err == nil && paths[subsysFZ] != "" {
+		if state, err := freezerState(paths[subsysFZ]); err == nil && state != freezerThawed {
+			return StatusPaused
+		}
+	}
+	return StatusRunning
+}
+
+// masterRestarting asks the master of container whether it waits to restart
+// the init process.
+func (c *Container) masterRestarting() bool {
+	live := new(Container)
+	if err := callControl(c, "Info", &struct{}{}, live); err != nil {
+		return false
+	}
+	return live.Restarting
+}
+
+// Containers loads all containers under TINYBOX_HOME.
+func Containers() ([]*Container, error) {
+	home, err := Home()
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(home, "*", "container.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var cs []*Container
+	for _, file := range files {
+		c, err := LoadContainer(filepath.Base(filepath.Dir(file)))
+		if err != nil {
+			log.Printf("Load %s error: %v \n", file, err)
+			continue
+		}
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
 func (c *Container) IsExec() bool {
 	return c.isExec
 }
@@ -174,6 +385,44 @@ func (c *Container) readPipe() error {
 	return json.NewDecoder(pipe).Decode(c)
 }
 
+// save writes the json of Container into disk, it's replaced by rename so
+// the readers never see a partial one.
+func (c *Container) save() error {
+	info, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	tmp := c.JsonFile() + ".tmp"
+	if err := ioutil.WriteFile(tmp, info, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.JsonFile())
+}
+
+// LogFile is where the output of container is captured.
+func (c *Container) LogFile() string {
+	return filepath.Join(c.Dir, "stdout.log")
+}
+
+// MonitorLogFile is the stdio of a detached monitor.
+func (c *Container) MonitorLogFile() string {
+	return filepath.Join(c.Dir, "monitor.log")
+}
+
+func (c *Container) AttachSocket() string {
+	return filepath.Join(c.Dir, "attach.sock")
+}
+
+func (c *Container) ControlSocket() string {
+	return filepath.Join(c.Dir, "control.sock")
+}
+
+// NsDir is where the namespace files are bind mounted with --persist-ns.
+func (c *Container) NsDir() string {
+	return filepath.Join(c.Dir, "ns")
+}
+
 func (c *Container) PipeFile() string {
 	return filepath.Join(c.Dir, "pipe")
 }
@@ -0,0 +1,196 @@
+package tinybox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	logFormatPlain = "plain"
+	logFormatJson  = "json"
+
+	maxLogLine = 16 * 1024 // a longer line is split
+)
+
+// logEntry is a line of the json log format.
+type logEntry struct {
+	Log    string    `json:"log"`
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+}
+
+// containerLog captures the output of container into the stdout.log of
+// container dir, it's rotated by size.
+type containerLog struct {
+	mu       sync.Mutex
+	path     string
+	format   string
+	maxSize  int64 // 0 is unlimited
+	maxFiles int   // the files kept, including the current one
+	file     *os.File
+	size     int64
+	streams  []*logStream
+}
+
+func openContainerLog(c *Container) (*containerLog, error) {
+	l := &containerLog{
+		path:     c.LogFile(),
+		format:   c.LogFormat,
+		maxSize:  c.LogMaxSize,
+		maxFiles: c.LogMaxFiles,
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *containerLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	l.file = file
+	l.size = fi.Size()
+	return nil
+}
+
+// stream returns the writer of the named stream, the output is written into
+// the log line by line.
+func (l *containerLog) stream(name string) io.Writer {
+	s := &logStream{l: l, name: name}
+
+	l.mu.Lock()
+	l.streams = append(l.streams, s)
+	l.mu.Unlock()
+
+	return s
+}
+
+func (l *containerLog) writeLine(stream string, line []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return os.ErrClosed
+	}
+
+	b := line
+	if l.format == logFormatJson {
+		var err error
+		if b, err = json.Marshal(&logEntry{Log: string(line), Stream: stream, Time: time.Now().UTC()}); err != nil {
+			return err
+		}
+		b = append(b, '\n')
+	}
+
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(b)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.file.Write(b)
+	l.size += int64(n)
+	return err
+}
+
+// rotate renames stdout.log to stdout.log.1, stdout.log.1 to stdout.log.2
+// and so on, the oldest one is removed.
+func (l *containerLog) rotate() error {
+	l.file.Close()
+	l.file = nil
+
+	if l.maxFiles <= 1 {
+		if err := os.Truncate(l.path, 0); err != nil {
+			return err
+		}
+		return l.open()
+	}
+
+	os.Remove(rotatedLog(l.path, l.maxFiles-1))
+	for i := l.maxFiles - 2; i > 0; i-- {
+		os.Rename(rotatedLog(l.path, i), rotatedLog(l.path, i+1))
+	}
+	if err := os.Rename(l.path, rotatedLog(l.path, 1)); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+// Close writes the unterminated lines, and closes the log file.
+func (l *containerLog) Close() error {
+	l.mu.Lock()
+	streams := l.streams
+	l.mu.Unlock()
+
+	for _, s := range streams {
+		s.flush()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+func rotatedLog(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+// logStream splits the output of a stream into lines.
+type logStream struct {
+	mu   sync.Mutex
+	l    *containerLog
+	name string
+	buf  []byte
+}
+
+// Write never fails, so the output to the others isn't broken by the log.
+func (s *logStream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buf = append(s.buf, p...)
+	for {
+		i := bytes.IndexByte(s.buf, '\n') + 1
+		if i == 0 {
+			if len(s.buf) < maxLogLine {
+				break
+			}
+			i = maxLogLine
+		}
+		if err := s.l.writeLine(s.name, s.buf[:i]); err != nil {
+			log.Printf("Write container log error: %v \n", err)
+		}
+		s.buf = s.buf[i:]
+	}
+	return len(p), nil
+}
+
+func (s *logStream) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.buf) > 0 {
+		s.l.writeLine(s.name, s.buf)
+		s.buf = nil
+	}
+}
@@ -0,0 +1,185 @@
+package tinybox
+
+import (
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"time"
+)
+
+// The control socket of master speaks JSON-RPC, the methods are of the
+// "Container" service, like "Container.Stop".
+const controlService = "Container"
+
+// controlTimeout is the deadline of a control call, the master could be
+// blocked, like by a hung hook.
+const controlTimeout = 30 * time.Second
+
+type KillArgs struct {
+	Signal string `json:"signal"`
+}
+
+type ExecArgs struct {
+	Args    []string `json:"args"`
+	Timeout int      `json:"timeout"` // seconds, 0 is no timeout
+}
+
+type ExecReply struct {
+	Code   int    `json:"code"`
+	Output string `json:"output"` // the combined stdout and stderr
+}
+
+// controlServer serves the control socket of master.
+type controlServer struct {
+	ln   net.Listener
+	path string
+}
+
+func newControlServer(p *masterProcess, path string) (*controlServer, error) {
+	srv := rpc.NewServer()
+	if err := srv.RegisterName(controlService, &controlAPI{p}); err != nil {
+		return nil, err
+	}
+
+	os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.ServeCodec(jsonrpc.NewServerCodec(conn))
+		}
+	}()
+
+	return &controlServer{ln: ln, path: path}, nil
+}
+
+func (s *controlServer) Close() error {
+	err := s.ln.Close()
+	os.Remove(s.path)
+	return err
+}
+
+// controlAPI is the methods of control socket, every call is sent to the
+// event loop of master as an event, and replied by it.
+type controlAPI struct {
+	p *masterProcess
+}
+
+// call sends an event to the event loop and waits its reply.
+func (p *masterProcess) call(action string, data interface{}) (interface{}, error) {
+	ev := event{
+		action: action,
+		data:   data,
+		c:      make(chan interface{}, 1),
+	}
+
+	select {
+	case p.ec <- ev:
+	case <-p.stop:
+		return nil, fmt.Errorf("Container stopped")
+	}
+
+	var v interface{}
+	select {
+	case v = <-ev.c:
+	case <-p.stop:
+		// The event which stops the master is replied before.
+		select {
+		case v = <-ev.c:
+		default:
+			return nil, fmt.Errorf("Container stopped")
+		}
+	}
+
+	if err, ok := v.(error); ok {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (api *controlAPI) Info(args *struct{}, reply *Container) error {
+	v, err := api.p.call(evInfo, nil)
+	if err != nil {
+		return err
+	}
+	*reply = *v.(*Container)
+	return nil
+}
+
+func (api *controlAPI) Stop(args *struct{}, reply *struct{}) error {
+	_, err := api.p.call(evStop, nil)
+	return err
+}
+
+func (api *controlAPI) Kill(args *KillArgs, reply *struct{}) error {
+	sig, err := ParseSignal(args.Signal)
+	if err != nil {
+		return err
+	}
+	_, err = api.p.call(evSignal, sig)
+	return err
+}
+
+func (api *controlAPI) Pause(args *struct{}, reply *struct{}) error {
+	_, err := api.p.call(evPause, nil)
+	return err
+}
+
+func (api *controlAPI) Resume(args *struct{}, reply *struct{}) error {
+	_, err := api.p.call(evResume, nil)
+	return err
+}
+
+func (api *controlAPI) Stats(args *struct{}, reply *Stats) error {
+	v, err := api.p.call(evStats, nil)
+	if err != nil {
+		return err
+	}
+	*reply = *v.(*Stats)
+	return nil
+}
+
+func (api *controlAPI) Exec(args *ExecArgs, reply *ExecReply) error {
+	if len(args.Args) == 0 {
+		return ErrOptNoRun
+	}
+	v, err := api.p.call(evExec, args)
+	if err != nil {
+		return err
+	}
+	*reply = *v.(*ExecReply)
+	return nil
+}
+
+func (api *controlAPI) Update(args *CGroupOptions, reply *CGroupOptions) error {
+	v, err := api.p.call(evUpdate, args)
+	if err != nil {
+		return err
+	}
+	*reply = *v.(*CGroupOptions)
+	return nil
+}
+
+// callControl calls the method of container's control socket.
+func callControl(c *Container, method string, args interface{}, reply interface{}) error {
+	conn, err := net.DialTimeout("unix", c.ControlSocket(), 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("Container %s is not running: %v", c.Name, err)
+	}
+
+	conn.SetDeadline(time.Now().Add(controlTimeout))
+
+	client := jsonrpc.NewClient(conn)
+	defer client.Close()
+
+	return client.Call(controlService+"."+method, args, reply)
+}
@@ -0,0 +1,148 @@
+package tinybox
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// The health status of container.
+const (
+	healthStarting  = "starting"
+	healthHealthy   = "healthy"
+	healthUnhealthy = "unhealthy"
+)
+
+// The actions when container becomes unhealthy.
+const (
+	unhealthyNone    = "none"
+	unhealthyRestart = "restart"
+	unhealthyStop    = "stop"
+)
+
+const (
+	healthLogSize   = 5
+	healthMaxOutput = 4 << 10
+)
+
+// HealthConfig is how the health of container is checked.
+type HealthConfig struct {
+	Argv        []string      `json:"argv"`
+	Interval    time.Duration `json:"interval"`
+	Timeout     time.Duration `json:"timeout"`
+	Retries     int           `json:"retries"`     // failures in a row to be unhealthy
+	StartPeriod time.Duration `json:"startperiod"` // failures in it aren't counted
+	OnUnhealthy string        `json:"onunhealthy"` // none, restart or stop
+}
+
+// HealthState is the health of container with the last results.
+type HealthState struct {
+	Status        string          `json:"status"`
+	FailingStreak int             `json:"failingstreak"`
+	Log           []*HealthResult `json:"log"`
+}
+
+type HealthResult struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Code   int       `json:"code"`
+	Output string    `json:"output"`
+
+	pid int // the init process checked
+}
+
+// record adds the result into the log, and returns true if container just
+// became unhealthy.
+func (h *HealthState) record(cfg *HealthConfig, r *HealthResult, startedAt time.Time) bool {
+	if h.Log = append(h.Log, r); len(h.Log) > healthLogSize {
+		h.Log = h.Log[len(h.Log)-healthLogSize:]
+	}
+
+	if r.Code == 0 {
+		h.Status = healthHealthy
+		h.FailingStreak = 0
+		return false
+	}
+
+	if h.Status == healthStarting && r.Start.Sub(startedAt) < cfg.StartPeriod {
+		return false
+	}
+
+	h.FailingStreak++
+	if h.FailingStreak >= cfg.Retries && h.Status != healthUnhealthy {
+		h.Status = healthUnhealthy
+		return true
+	}
+	return false
+}
+
+// healthCheck runs the health command in container every interval, until
+// the master stops. The results are handled by the event loop.
+func (p *masterProcess) healthCheck(cfg *HealthConfig) {
+	for {
+		select {
+		case <-time.After(cfg.Interval):
+		case <-p.stop:
+			return
+		}
+
+		v, err := p.call(evInfo, nil)
+		if err != nil {
+			return
+		}
+		c := v.(*Container)
+
+		// Not checked while restarting.
+		if c.Exit != nil {
+			continue
+		}
+
+		r := &HealthResult{Start: time.Now(), pid: c.Pid}
+		code, output, err := runExec(c, cfg.Argv, cfg.Timeout)
+		r.End = time.Now()
+		switch {
+		case err != nil:
+			r.Code, r.Output = -1, err.Error()
+		case r.End.Sub(r.Start) >= cfg.Timeout:
+			r.Code, r.Output = -1, fmt.Sprintf("Health check timed out after %s", cfg.Timeout)
+		default:
+			r.Code, r.Output = code, output
+		}
+		if len(r.Output) > healthMaxOutput {
+			r.Output = r.Output[:healthMaxOutput]
+		}
+
+		select {
+		case p.ec <- event{action: evHealth, data: r}:
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// health records the result of health check, and takes the action if the
+// container became unhealthy.
+func (p *masterProcess) health(c *Container, r *HealthResult) {
+	// The result of an init process which was restarted.
+	if r.pid != c.Pid || c.Exit != nil {
+		return
+	}
+
+	unhealthy := c.Health.record(c.Healthcheck, r, c.StartedAt)
+	if err := c.save(); err != nil {
+		log.Println(err)
+	}
+	if !unhealthy {
+		return
+	}
+
+	log.Printf("Container %s is unhealthy, %d checks failed \n", c.Name, c.Health.FailingStreak)
+
+	switch c.Healthcheck.OnUnhealthy {
+	case unhealthyRestart:
+		p.forceRestart = true
+		p.killAll(c)
+	case unhealthyStop:
+		p.stopContainer(c)
+	}
+}
@@ -0,0 +1,62 @@
+package tinybox
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHealthRecord(t *testing.T) {
+	cfg := &HealthConfig{Retries: 3, StartPeriod: 10 * time.Second}
+	started := time.Now()
+
+	// A sequence of results, each after the start of container.
+	steps := []struct {
+		after     time.Duration
+		code      int
+		status    string
+		streak    int
+		unhealthy bool // just became unhealthy
+	}{
+		// The failures in the start period aren't counted.
+		{after: time.Second, code: 1, status: healthStarting},
+		{after: 5 * time.Second, code: 1, status: healthStarting},
+		// Counted after it.
+		{after: 11 * time.Second, code: 1, status: healthStarting, streak: 1},
+		{after: 12 * time.Second, code: 0, status: healthHealthy},
+		{after: 13 * time.Second, code: 1, status: healthHealthy, streak: 1},
+		{after: 14 * time.Second, code: 1, status: healthHealthy, streak: 2},
+		// Unhealthy at the retries, only reported once.
+		{after: 15 * time.Second, code: 1, status: healthUnhealthy, streak: 3, unhealthy: true},
+		{after: 16 * time.Second, code: 1, status: healthUnhealthy, streak: 4},
+		{after: 17 * time.Second, code: 0, status: healthHealthy},
+	}
+
+	h := &HealthState{Status: healthStarting}
+	for i, s := range steps {
+		r := &HealthResult{Start: started.Add(s.after), Code: s.code}
+		unhealthy := h.record(cfg, r, started)
+		if unhealthy != s.unhealthy || h.Status != s.status || h.FailingStreak != s.streak {
+			t.Fatalf("step %d: record = %v, status %s, streak %d, want %v, %s, %d",
+				i, unhealthy, h.Status, h.FailingStreak, s.unhealthy, s.status, s.streak)
+		}
+	}
+
+	if len(h.Log) != healthLogSize {
+		t.Errorf("log size = %d, want %d", len(h.Log), healthLogSize)
+	}
+	if last := h.Log[len(h.Log)-1]; !last.Start.Equal(started.Add(17 * time.Second)) {
+		t.Errorf("last log at %s, want the latest result", last.Start.Sub(started))
+	}
+}
+
+func TestHealthRecordHealthyInStartPeriod(t *testing.T) {
+	cfg := &HealthConfig{Retries: 1, StartPeriod: time.Minute}
+	started := time.Now()
+
+	// A healthy container leaves the start period, so its failures count.
+	h := &HealthState{Status: healthStarting}
+	h.record(cfg, &HealthResult{Start: started.Add(time.Second)}, started)
+	if !h.record(cfg, &HealthResult{Start: started.Add(2 * time.Second), Code: 1}, started) {
+		t.Errorf("not unhealthy after a failure of a healthy container")
+	}
+}
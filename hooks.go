@@ -0,0 +1,141 @@
+package tinybox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// Hook is an executable run by the master around the lifecycle of container,
+// modeled on the OCI hooks.
+type Hook struct {
+	Path    string   `json:"path"`
+	Args    []string `json:"args,omitempty"` // including argv[0], default is the path
+	Env     []string `json:"env,omitempty"`
+	Timeout int      `json:"timeout,omitempty"` // seconds, 0 is no timeout
+}
+
+// Hooks run at the stages of container. The prestart hooks run after the init
+// process joined the cgroups and before it runs the command, a failing one
+// aborts the start. The poststart hooks run after the command started, and
+// the poststop hooks after container stopped.
+type Hooks struct {
+	Prestart  []*Hook `json:"prestart,omitempty"`
+	Poststart []*Hook `json:"poststart,omitempty"`
+	Poststop  []*Hook `json:"poststop,omitempty"`
+}
+
+// hookState is the state of container on the stdin of hooks, in the format
+// of the OCI state.
+type hookState struct {
+	Version string `json:"ociVersion"`
+	ID      string `json:"id"`
+	Status  string `json:"status"`
+	Pid     int    `json:"pid,omitempty"`
+	Bundle  string `json:"bundle"`
+	Rootfs  string `json:"rootfs,omitempty"`
+}
+
+const hookStateVersion = "1.0.2"
+
+// hookStopped is the OCI status of an exited container.
+const hookStopped = "stopped"
+
+// hookWaitDelay is how long the output of an exited hook is waited.
+const hookWaitDelay = time.Second
+
+// loadHooks reads the hooks from a json file.
+func loadHooks(file string) (*Hooks, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	hooks := new(Hooks)
+	if err := json.Unmarshal(b, hooks); err != nil {
+		return nil, fmt.Errorf("Invalid hooks %s: %v", file, err)
+	}
+
+	for _, stage := range [][]*Hook{hooks.Prestart, hooks.Poststart, hooks.Poststop} {
+		for _, hook := range stage {
+			if !filepath.IsAbs(hook.Path) {
+				return nil, fmt.Errorf("Hook path must be absolute: %s", hook.Path)
+			}
+			if hook.Timeout < 0 {
+				return nil, fmt.Errorf("Invalid hook timeout: %d", hook.Timeout)
+			}
+		}
+	}
+	return hooks, nil
+}
+
+// runHooks runs the hooks of a stage in order with the state of container,
+// it stops at the first failing one.
+func runHooks(c *Container, stage string, hooks []*Hook, status string) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	state, err := json.Marshal(&hookState{
+		Version: hookStateVersion,
+		ID:      c.Name,
+		Status:  status,
+		Pid:     c.Pid,
+		Bundle:  c.Dir,
+		Rootfs:  c.Rootfs,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range hooks {
+		if err := runHook(hook, state); err != nil {
+			return fmt.Errorf("Run %s hook %s error: %v", stage, hook.Path, err)
+		}
+	}
+	return nil
+}
+
+func runHook(hook *Hook, state []byte) error {
+	ctx := context.Background()
+	if hook.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(hook.Timeout)*time.Second)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, hook.Path)
+	if len(hook.Args) > 0 {
+		cmd.Args = hook.Args
+	}
+	// The hook has only its own environment, not the master's.
+	cmd.Env = []string{}
+	if len(hook.Env) > 0 {
+		cmd.Env = hook.Env
+	}
+	cmd.Stdin = bytes.NewReader(state)
+
+	// The children left by the hook could keep the output open, it's
+	// closed after the delay once the hook exited or was killed.
+	cmd.WaitDelay = hookWaitDelay
+
+	output, err := cmd.CombinedOutput()
+	if len(output) > 0 {
+		log.Printf("Hook %s output: %s \n", hook.Path, bytes.TrimSpace(output))
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timeout after %ds", hook.Timeout)
+	}
+	if errors.Is(err, exec.ErrWaitDelay) {
+		log.Printf("Hook %s left the output open \n", hook.Path)
+		return nil
+	}
+	return err
+}
@@ -1,17 +1,36 @@
 package tinybox
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"syscall"
+	"time"
 )
 
+// The namespaces which could be joined from another container, by the
+// names of /proc/<pid>/ns.
+var joinableNs = []string{"net", "ipc", "pid", "uts"}
+
+// The namespaces which are persisted by --persist-ns. A pid namespace can't
+// be entered after its init process exits, so it's not one of them.
+var persistableNs = []string{"net", "ipc", "uts", "mnt"}
+
+// nsfsMagic is the filesystem type of the namespace files.
+const nsfsMagic = 0x6e736673
+
 func newNamespace() NamespaceManager {
 	return NamespaceManager{
-		"MNT":  &setNS{clone: syscall.CLONE_NEWNS},
-		"UTS":  &setUTS{clone: syscall.CLONE_NEWUTS},
-		"PID":  &setPID{clone: syscall.CLONE_NEWPID},
-		"NET":  &setNET{clone: syscall.CLONE_NEWNET},
-		"USER": &setUSER{clone: syscall.CLONE_NEWUSER},
-		"IPC":  &setIPC{clone: syscall.CLONE_NEWIPC},
+		"MNT":    &setNS{clone: syscall.CLONE_NEWNS},
+		"UTS":    &setUTS{clone: syscall.CLONE_NEWUTS},
+		"PID":    &setPID{clone: syscall.CLONE_NEWPID},
+		"NET":    &setNET{clone: syscall.CLONE_NEWNET},
+		"USER":   &setUSER{clone: syscall.CLONE_NEWUSER},
+		"IPC":    &setIPC{clone: syscall.CLONE_NEWIPC},
+		"CGROUP": &setCGROUP{clone: syscall.CLONE_NEWCGROUP},
+		"TIME":   &setTIME{clone: syscall.CLONE_NEWTIME},
 	}
 }
 
@@ -23,6 +42,12 @@ type namespaceSetter interface {
 type NamespaceManager map[string]namespaceSetter
 
 func (m NamespaceManager) Cloneflags(c *Container) uintptr {
+	// The infra container of pod has no rootfs, it only creates the pod
+	// namespaces.
+	if c.Infra {
+		return syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS
+	}
+
 	if c.Rootfs == "" {
 		c.Hostname = "" // If not set rootfs, don't set namespace and hostname.
 		return 0
@@ -30,13 +55,140 @@ func (m NamespaceManager) Cloneflags(c *Container) uintptr {
 
 	var flag uintptr
 
-	for _, set := range m {
+	for typ, set := range m {
+		// The joined namespaces aren't created.
+		if c.JoinNs[strings.ToLower(typ)] != "" {
+			continue
+		}
 		flag |= set.flag(c)
 	}
 	return flag
 }
 
+// Join switches the current thread into the namespaces which container
+// joins, so the init process forked from it is in them. The caller must lock
+// the thread, and throw it away after the fork.
+func (m NamespaceManager) Join(c *Container) error {
+	var types []string
+	for typ := range c.JoinNs {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+
+	for _, typ := range types {
+		path, err := joinPath(c.JoinNs[typ], typ)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(path)
+		if err == nil {
+			err = setnsFile(f)
+			f.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("Join %s namespace of %s error: %v", typ, c.JoinNs[typ], err)
+		}
+	}
+	return nil
+}
+
+// joinPath returns the namespace file of the named container, the one
+// bind mounted in its dir is preferred.
+func joinPath(name, typ string) (string, error) {
+	target, err := LoadContainer(name)
+	if err != nil {
+		return "", err
+	}
+
+	if path := filepath.Join(target.Dir, "ns", typ); isNsFile(path) {
+		return path, nil
+	}
+
+	if target.Exit != nil || !processStarted(target.Pid, target.StartTime) {
+		return "", fmt.Errorf("Container %s is not running", name)
+	}
+	return fmt.Sprintf("/proc/%d/ns/%s", target.Pid, typ), nil
+}
+
+// persistNamespaces bind mounts the namespace files of the init process into
+// the ns dir, the ones of the last init process are replaced. The namespaces
+// which aren't created for container, like the host ones, are skipped.
+func persistNamespaces(c *Container) error {
+	dir := c.NsDir()
+	if err := unmountUnder(dir); err != nil {
+		return err
+	}
+	if err := MkdirIfNotExist(dir); err != nil {
+		return err
+	}
+
+	// The dir is a private mount, so the mount namespace file isn't
+	// propagated into the mount namespace itself, which is a loop.
+	if err := syscall.Mount(dir, dir, "", syscall.MS_BIND, ""); err != nil {
+		return fmt.Errorf("Bind mount %s error: %v", dir, err)
+	}
+	if err := syscall.Mount("", dir, "", syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("Make %s private error: %v", dir, err)
+	}
+
+	for _, typ := range persistableNs {
+		src := fmt.Sprintf("/proc/%d/ns/%s", c.Pid, typ)
+		if sameNs(src, fmt.Sprintf("/proc/%d/ns/%s", os.Getpid(), typ)) {
+			continue
+		}
+
+		file := filepath.Join(dir, typ)
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_RDONLY, 0444)
+		if err != nil {
+			return err
+		}
+		f.Close()
+
+		if err := syscall.Mount(src, file, "", syscall.MS_BIND, ""); err != nil {
+			return fmt.Errorf("Bind mount %s error: %v", src, err)
+		}
+	}
+	return nil
+}
+
+// sameNs reports whether the namespace files are the same namespace.
+func sameNs(a, b string) bool {
+	var sa, sb syscall.Stat_t
+	if syscall.Stat(a, &sa) != nil || syscall.Stat(b, &sb) != nil {
+		return false
+	}
+	return sa.Dev == sb.Dev && sa.Ino == sb.Ino
+}
+
+// isNsFile reports whether path is a namespace file, like a bind mounted one.
+func isNsFile(path string) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return false
+	}
+	return st.Type == nsfsMagic
+}
+
+func setnsFile(f *os.File) error {
+	if _, _, e := syscall.RawSyscall(sysSetns, f.Fd(), 0, 0); e != 0 {
+		return e
+	}
+	return nil
+}
+
+// Setup creates the namespaces which the init process unshares itself, it's
+// called by the init process before it runs the command.
 func (m NamespaceManager) Setup(c *Container) error {
+	if c.Rootfs == "" {
+		return nil
+	}
+
+	for _, set := range m {
+		if err := set.setup(c); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -105,3 +257,48 @@ type setIPC struct {
 func (s setIPC) flag(c *Container) uintptr {
 	return uintptr(s.clone)
 }
+
+// Set cgroup namespace. It's unshared by the init process after the master
+// joined it into the cgroups, so the cgroups of container are its root.
+type setCGROUP struct {
+	clone int
+}
+
+func (s setCGROUP) flag(c *Container) uintptr {
+	return uintptr(0)
+}
+
+func (s setCGROUP) setup(c *Container) error {
+	if err := syscall.Unshare(s.clone); err != nil {
+		return fmt.Errorf("Unshare cgroup namespace error: %v", err)
+	}
+	return nil
+}
+
+// Set time namespace. The offsets can only be written before any process is
+// in it, and only for the main thread, so it's unshared by nsexec when the
+// init process starts. The command enters it by exec.
+type setTIME struct {
+	baseN
+	clone int
+}
+
+func (s setTIME) flag(c *Container) uintptr {
+	return uintptr(0)
+}
+
+// String formats the offsets as /proc/<pid>/timens_offsets.
+func (t *TimeOffsets) String() string {
+	return fmt.Sprintf("monotonic %s\nboottime %s\n", secNsec(t.Monotonic), secNsec(t.Boottime))
+}
+
+// secNsec formats d as the seconds and nanoseconds, the kernel takes the
+// nanoseconds in [0, 1e9) only, so a negative d borrows them from a second.
+func secNsec(d time.Duration) string {
+	sec, nsec := d/time.Second, d%time.Second
+	if nsec < 0 {
+		sec--
+		nsec += time.Second
+	}
+	return fmt.Sprintf("%d %d", sec, nsec)
+}
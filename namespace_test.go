@@ -0,0 +1,37 @@
+package tinybox
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSecNsec(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0 0"},
+		{time.Second, "1 0"},
+		{24 * time.Hour, "86400 0"},
+		{1500 * time.Millisecond, "1 500000000"},
+		{time.Nanosecond, "0 1"},
+		{-time.Second, "-1 0"},
+		{-1500 * time.Millisecond, "-2 500000000"},
+		{-500 * time.Millisecond, "-1 500000000"},
+		{-time.Nanosecond, "-1 999999999"},
+	}
+
+	for _, tt := range tests {
+		if got := secNsec(tt.d); got != tt.want {
+			t.Errorf("secNsec(%s) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestTimeOffsetsString(t *testing.T) {
+	offsets := &TimeOffsets{Monotonic: 100*time.Second + 5, Boottime: -1500 * time.Millisecond}
+	want := "monotonic 100 5\nboottime -2 500000000\n"
+	if got := offsets.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
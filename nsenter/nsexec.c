@@ -16,6 +16,7 @@
 #include <setjmp.h>
 #include <sched.h>
 #include <signal.h>
+#include <stdarg.h>
 
 /* All arguments should be above stack, because it grows down */
 struct clone_arg {
@@ -53,6 +54,36 @@ int setns(int fd, int nstype)
 }
 #endif
 
+#ifndef CLONE_NEWTIME
+#define CLONE_NEWTIME 0x00000080
+#endif
+
+/*
+ * The init process creates its time namespace before the Go runtime starts
+ * threads, the offsets are only written for the main thread. The command
+ * enters it by exec.
+ */
+static void unshare_time(char *offsets)
+{
+	int fd, len = strlen(offsets);
+
+	if (unshare(CLONE_NEWTIME) == -1) {
+		pr_perror("Failed to unshare time namespace");
+		exit(1);
+	}
+
+	fd = open("/proc/self/timens_offsets", O_WRONLY);
+	if (fd == -1) {
+		pr_perror("Failed to open /proc/self/timens_offsets");
+		exit(1);
+	}
+	if (write(fd, offsets, len) != len) {
+		pr_perror("Failed to write time offsets");
+		exit(1);
+	}
+	close(fd);
+}
+
 static int clone_parent(jmp_buf * env) __attribute__ ((noinline));
 static int clone_parent(jmp_buf * env)
 {
@@ -65,88 +96,163 @@ static int clone_parent(jmp_buf * env)
 	return child;
 }
 
-void nsexec()
+/* A namespace to join, sent by the master as a "<type> <path>" line */
+struct ns_file {
+	char type[16];
+	char path[PATH_MAX];
+};
+
+#define NS_MAX 16
+
+/*
+ * Report an error to the master through the pipe as json, so it gets the
+ * reason instead of an EOF. It's also written to stderr.
+ */
+static void report_error(int pipe, const char *fmt, ...)
 {
-	int i, tfd, self_tfd, child, pipe, len, consolefd = -1;
-	char *namespaces[] = { "ipc", "uts", "pid", "mnt" };
-	char buf[PATH_MAX], *val;
-	pid_t pid;
-	jmp_buf env;
-	const int num = sizeof(namespaces) / sizeof(char *);
+	char msg[PATH_MAX], buf[2 * PATH_MAX + 32];
+	int i, len;
+	va_list ap;
 
-	if ((val = getenv("__TINYBOX_INIT_PID__")) == NULL) {
-		return;
-    }
+	va_start(ap, fmt);
+	vsnprintf(msg, sizeof(msg), fmt, ap);
+	va_end(ap);
 
-	pid = atoi(val);
-	snprintf(buf, sizeof(buf), "%d", pid);
-	if (strcmp(val, buf)) {
-		pr_perror("__TINYBOX_INIT_PID__ invalid");
-		exit(1);
+	fprintf(stderr, "nsenter: %s\n", msg);
+
+	len = snprintf(buf, sizeof(buf), "{ \"Error\" : \"");
+	for (i = 0; msg[i] != '\0'; i++) {
+		if (msg[i] == '"' || msg[i] == '\\')
+			buf[len++] = '\\';
+		buf[len++] = (msg[i] == '\n' || msg[i] == '\t') ? ' ' : msg[i];
 	}
+	len += snprintf(buf + len, sizeof(buf) - len, "\" }\n");
 
+	if (write(pipe, buf, len) != len)
+		pr_perror("Unable to send the error");
+}
 
-    if ((val = getenv("__TINYBOX_PIPE__")) == NULL) {
-        return;
-    }
+#define bail(pipe, fmt, ...)						\
+	do {								\
+		report_error(pipe, fmt ": %m", ##__VA_ARGS__);	\
+		exit(1);						\
+	} while (0)
 
-    pipe = atoi(val);
-    snprintf(buf, sizeof(buf), "%d", pipe);
-    if (strcmp(val, buf)) {
-        pr_perror("__TINYBOX_PIPE__ invalid");
-        exit(1);
-    }
+/*
+ * Read the namespaces to join in order, one per line until an empty line.
+ * The user namespace comes first, it grants the privileges in the others.
+ */
+static int read_namespaces(int pipe, struct ns_file *nss)
+{
+	char line[PATH_MAX + 32], *sep, c;
+	int n = 0, len = 0;
 
+	for (;;) {
+		switch (read(pipe, &c, 1)) {
+		case 1:
+			break;
+		case 0:
+			errno = EPIPE;
+			/* fallthrough */
+		default:
+			bail(pipe, "Failed to read namespaces");
+		}
 
-	/* Check that the specified process exists */
-	snprintf(buf, PATH_MAX - 1, "/proc/%d/ns", pid);
-	tfd = open(buf, O_DIRECTORY | O_RDONLY);
-	if (tfd == -1) {
-		pr_perror("Failed to open \"%s\"", buf);
-		exit(1);
+		if (c != '\n') {
+			if (len == sizeof(line) - 1) {
+				errno = ENAMETOOLONG;
+				bail(pipe, "Failed to read namespaces");
+			}
+			line[len++] = c;
+			continue;
+		}
+
+		if (len == 0)
+			return n;
+		line[len] = '\0';
+		len = 0;
+
+		if (n == NS_MAX) {
+			errno = E2BIG;
+			bail(pipe, "Failed to read namespaces");
+		}
+		/* The path is the rest of the line, it could have spaces. */
+		sep = strchr(line, ' ');
+		if (sep == NULL || sep == line || sep - line >= sizeof(nss[n].type) ||
+		    strlen(sep + 1) == 0 || strlen(sep + 1) >= sizeof(nss[n].path)) {
+			errno = EINVAL;
+			bail(pipe, "Invalid namespace line %s", line);
+		}
+		*sep = '\0';
+		strcpy(nss[n].type, line);
+		strcpy(nss[n].path, sep + 1);
+		n++;
 	}
+}
 
-	self_tfd = open("/proc/self/ns", O_DIRECTORY | O_RDONLY);
-	if (self_tfd == -1) {
-		pr_perror("Failed to open /proc/self/ns");
+void nsexec()
+{
+	int i, num, self_tfd, child, pipe, len, consolefd = -1;
+	int fds[NS_MAX];
+	struct ns_file nss[NS_MAX];
+	char buf[PATH_MAX], *val;
+	jmp_buf env;
+
+	if ((val = getenv("__TINYBOX_TIME_OFFSETS__")) != NULL) {
+		unshare_time(val);
+		unsetenv("__TINYBOX_TIME_OFFSETS__");
+	}
+
+	if ((val = getenv("__TINYBOX_PIPE__")) == NULL) {
+		return;
+	}
+
+	pipe = atoi(val);
+	snprintf(buf, sizeof(buf), "%d", pipe);
+	if (strcmp(val, buf)) {
+		pr_perror("__TINYBOX_PIPE__ invalid");
 		exit(1);
 	}
 
+	num = read_namespaces(pipe, nss);
+
+	self_tfd = open("/proc/self/ns", O_DIRECTORY | O_RDONLY);
+	if (self_tfd == -1)
+		bail(pipe, "Failed to open /proc/self/ns");
+
+	/*
+	 * Open all the namespace files before joining any of them, the paths
+	 * may not be reachable once we're in the user or mnt namespace.
+	 */
 	for (i = 0; i < num; i++) {
 		struct stat st;
 		struct stat self_st;
-		int fd;
-
-		/* Symlinks on all namespaces exist for dead processes, but they can't be opened */
-		if (fstatat(tfd, namespaces[i], &st, 0) == -1) {
-			// Ignore nonexistent namespaces.
-			if (errno == ENOENT)
-				continue;
-		}
 
-		/* Skip namespaces we're already part of */
-		if (fstatat(self_tfd, namespaces[i], &self_st, 0) != -1 &&
-		    st.st_ino == self_st.st_ino) {
-			continue;
-		}
+		fds[i] = open(nss[i].path, O_RDONLY);
+		if (fds[i] == -1)
+			bail(pipe, "Failed to open %s namespace %s", nss[i].type, nss[i].path);
 
-		fd = openat(tfd, namespaces[i], O_RDONLY);
-		if (fd == -1) {
-			pr_perror("Failed to open ns file %s for ns %s", buf,
-				  namespaces[i]);
-			exit(1);
-		}
-		// Set the namespace.
-		if (setns(fd, 0) == -1) {
-			pr_perror("Failed to setns for %s", namespaces[i]);
-			exit(1);
+		/* Skip namespaces we're already part of, like the host ones */
+		if (fstat(fds[i], &st) == -1)
+			bail(pipe, "Failed to stat %s namespace %s", nss[i].type, nss[i].path);
+		if (fstatat(self_tfd, nss[i].type, &self_st, 0) != -1 &&
+		    st.st_dev == self_st.st_dev && st.st_ino == self_st.st_ino) {
+			close(fds[i]);
+			fds[i] = -1;
 		}
-		close(fd);
 	}
 
 	close(self_tfd);
-	close(tfd);
 
+	for (i = 0; i < num; i++) {
+		if (fds[i] == -1)
+			continue;
+
+		// Set the namespace.
+		if (setns(fds[i], 0) == -1)
+			bail(pipe, "Failed to setns for %s namespace %s", nss[i].type, nss[i].path);
+		close(fds[i]);
+	}
 
 	if (setjmp(env) == 1) {
 		// Child
@@ -184,10 +290,8 @@ void nsexec()
 	// so the child can have the right parent, and we don't need to forward
 	// the child's exit code or resend its death signal.
 	child = clone_parent(&env);
-	if (child < 0) {
-		pr_perror("Unable to fork");
-		exit(1);
-	}
+	if (child < 0)
+		bail(pipe, "Unable to fork");
 
 	len = snprintf(buf, sizeof(buf), "{ \"Pid\" : %d }\n", child);
 
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 )
 
 var (
@@ -15,27 +16,102 @@ var (
 	ErrOptInvalidName = fmt.Errorf("Invalid container's name")
 )
 
-// tinybox --run='' --name='' --root=''
-// tinybox --exe='' --name=''
+// tinybox <name> --root='' [options] -- command [args...]
+// tinybox <name> --exec [options] -- command [args...]
+//
+// The quoted forms --run='command args' and --exec='command args' are still
+// accepted for backward compatibility.
 
 type Options struct {
 	run      string
-	exec     string
-	argv     string
-	args     []string
+	exec     execFlag
+	argv     []string
 	name     string
 	root     string
 	wd       string
 	hostname string
-	cgopts   CGroupOptions
+	init     bool
+	tty      bool
+	detach   bool
+	cmdline  []string
+
+	logFormat   string
+	logMaxSize  int64
+	logMaxFiles int
+	logSize     string
+	stopSig     string
+	stopTime    int
+	restart     string
+	hooksFile   string
+	hooks       *Hooks
+	cgopts      CGroupOptions
+
+	// namespace and pod options, nsFlags are --net, --ipc, --pid and --uts
+	nsFlags   map[string]*string
+	joinNs    map[string]string
+	pod       string
+	podInfra  bool
+	persistNs bool
+
+	timeMonotonic time.Duration
+	timeBoottime  time.Duration
+
+	// --exec options
+	execEnv     envFlag
+	execUser    string
+	execWorkdir string
+	interactive bool
+
+	healthCmd         string
+	healthArgv        []string
+	healthInterval    time.Duration
+	healthTimeout     time.Duration
+	healthRetries     int
+	healthStartPeriod time.Duration
+	healthOnUnhealthy string
 }
 
 func (o *Options) register() {
 	flag.StringVar(&o.run, "run", "", "Container run command")
-	flag.StringVar(&o.exec, "exec", "", "")
+	flag.Var(&o.exec, "exec", "Exec a command in the running container")
 	flag.StringVar(&o.root, "root", "", "Container rootfs path")
 	flag.StringVar(&o.wd, "wd", "/", "Container working directory")
 	flag.StringVar(&o.hostname, "hostname", "", "Container host name")
+	flag.BoolVar(&o.init, "init", false, "Run an init inside the container that forwards signals and reaps zombies")
+	flag.BoolVar(&o.tty, "t", false, "Allocate a pseudo-terminal, short of --tty")
+	flag.BoolVar(&o.tty, "tty", false, "Allocate a pseudo-terminal")
+	flag.BoolVar(&o.detach, "d", false, "Run container in background, short of --detach")
+	flag.BoolVar(&o.detach, "detach", false, "Run container in background and print its name and pid")
+	flag.Var(&o.execEnv, "e", "Set an environment variable of --exec like KEY=VAL, KEY is taken from ours, repeatable")
+	flag.StringVar(&o.execUser, "user", "", "User of --exec: name, uid, name:group or uid:gid")
+	flag.StringVar(&o.execWorkdir, "workdir", "", "Working directory of --exec, default is /")
+	flag.BoolVar(&o.interactive, "i", false, "Keep stdin open for --exec")
+	flag.StringVar(&o.logFormat, "log-format", logFormatPlain, "Format of the container log, plain or json")
+	flag.StringVar(&o.logSize, "log-max-size", "0", "Rotate the container log when it reaches the size, like 10m")
+	flag.IntVar(&o.logMaxFiles, "log-max-files", 1, "Number of container log files kept by rotation")
+	flag.StringVar(&o.stopSig, "stop-signal", "SIGTERM", "Signal sent to the init process to stop container")
+	flag.IntVar(&o.stopTime, "stop-timeout", 10, "Seconds to wait for container to stop before killing it")
+	flag.StringVar(&o.restart, "restart", restartNo, "Restart policy: no, on-failure[:max], always or unless-stopped")
+	flag.StringVar(&o.hooksFile, "hooks", "", "JSON file of the prestart, poststart and poststop hooks")
+
+	// namespace options
+	o.nsFlags = make(map[string]*string)
+	for _, typ := range joinableNs {
+		o.nsFlags[typ] = flag.String(typ, "", fmt.Sprintf("Join the %s namespace of another container, like container:<name>", typ))
+	}
+	flag.StringVar(&o.pod, "pod", "", "Run container in the pod, it joins the net, ipc and uts namespaces of pod")
+	flag.BoolVar(&o.podInfra, "pod-infra", false, "Run as the infra container of a pod, used by pod create")
+	flag.BoolVar(&o.persistNs, "persist-ns", false, "Bind mount the net, ipc, uts and mnt namespace files into the container dir")
+	flag.DurationVar(&o.timeMonotonic, "time-offset-monotonic", 0, "Offset of the monotonic clock in the time namespace, like 24h")
+	flag.DurationVar(&o.timeBoottime, "time-offset-boottime", 0, "Offset of the boottime clock in the time namespace, like 24h")
+
+	// health check options
+	flag.StringVar(&o.healthCmd, "health-cmd", "", "Command to check the health of container, like --run")
+	flag.DurationVar(&o.healthInterval, "health-interval", 30*time.Second, "Time between the health checks")
+	flag.DurationVar(&o.healthTimeout, "health-timeout", 30*time.Second, "Time a health check is allowed to run")
+	flag.IntVar(&o.healthRetries, "health-retries", 3, "Failures in a row to be unhealthy")
+	flag.DurationVar(&o.healthStartPeriod, "health-start-period", 0, "Time to start up, the failures in it aren't counted")
+	flag.StringVar(&o.healthOnUnhealthy, "health-on-unhealthy", unhealthyNone, "Action when unhealthy: none, restart or stop")
 
 	// cgroup options
 	flag.StringVar(&o.cgopts.CpuShares, "cpu-shares", "0", "")
@@ -43,6 +119,7 @@ func (o *Options) register() {
 	flag.StringVar(&o.cgopts.CpuCfsquota, "cpu-cfs-quota", "0", "")
 	flag.StringVar(&o.cgopts.CpusetCpus, "cpuset-cpus", "", "")
 	flag.StringVar(&o.cgopts.CpusetMems, "cpuset-mems", "", "")
+	flag.StringVar(&o.cgopts.Memory, "memory", "0", "Memory limit, like 512m")
 }
 
 func (o *Options) Parse() error {
@@ -52,14 +129,17 @@ func (o *Options) Parse() error {
 		return ErrOptInvalid
 	}
 
-	if o.name = os.Args[1]; o.name == "" {
-		return ErrOptInvalidName
+	o.name = os.Args[1]
+	if err := checkName(o.name); err != nil {
+		return err
 	}
 
 	if os.Args[0] == "init" || os.Args[0] == "setns" {
 		return nil
 	}
 
+	o.cmdline = append([]string(nil), os.Args...)
+
 	var tmp []string
 	tmp = append(tmp, os.Args[0])
 	tmp = append(tmp, os.Args[2:]...)
@@ -68,31 +148,280 @@ func (o *Options) Parse() error {
 	o.register()
 	flag.Parse()
 
-	o.argv = o.exec
-
 	var err error
 
-	if o.run != "" {
-		if o.argv, o.args, err = parseRun(o.run); err != nil {
+	// The trailing positional arguments are the exact argv, the quoted
+	// string of --run or --exec is only used when they are absent.
+	// The infra container of pod has no command.
+	if o.argv = flag.Args(); len(o.argv) == 0 && !o.podInfra {
+		cmd := o.run
+		if o.IsExec() {
+			cmd = o.exec.cmd
+		}
+		if o.argv, err = parseRun(cmd); err != nil {
+			return err
+		}
+	} else if o.IsExec() && o.exec.cmd == "" && len(o.argv) == 1 && !afterDashes(os.Args, o.argv) {
+		// The old form --exec 'command args', the bool flag leaves the
+		// quoted string in the arguments.
+		if o.argv, err = parseRun(o.argv[0]); err != nil {
 			return err
 		}
+	}
 
+	if o.IsExec() {
+		if o.detach && o.tty {
+			return fmt.Errorf("Can't allocate a pseudo-terminal for the detached exec")
+		}
+		if o.execWorkdir != "" && !path.IsAbs(o.execWorkdir) {
+			return fmt.Errorf("Working directory must be absolute: %s", o.execWorkdir)
+		}
+	} else if len(o.execEnv) != 0 || o.execUser != "" || o.execWorkdir != "" || o.interactive {
+		return fmt.Errorf("-e, --user, --workdir and -i are only for --exec")
+	}
+
+	if !o.IsExec() {
 		if o.root != "" && !path.IsAbs(o.root) {
 			return ErrOptNoRoot
 		}
+		if _, err := ParseSignal(o.stopSig); err != nil {
+			return err
+		}
+		if o.stopTime < 0 {
+			return fmt.Errorf("Invalid stop timeout: %d", o.stopTime)
+		}
+		if _, _, err := parseRestart(o.restart); err != nil {
+			return err
+		}
+		if err := o.parseHealth(); err != nil {
+			return err
+		}
+		if err := o.parseJoinNs(); err != nil {
+			return err
+		}
+		if err := o.parsePod(); err != nil {
+			return err
+		}
+		if (o.timeMonotonic != 0 || o.timeBoottime != 0) && o.root == "" {
+			return fmt.Errorf("Time offsets need the root path of container")
+		}
+		if o.hooksFile != "" {
+			if o.hooks, err = loadHooks(o.hooksFile); err != nil {
+				return err
+			}
+		}
+		if o.logFormat != logFormatPlain && o.logFormat != logFormatJson {
+			return fmt.Errorf("Invalid log format: %s", o.logFormat)
+		}
+		if o.logMaxSize, err = ParseSize(o.logSize); err != nil {
+			return err
+		}
+		if o.logMaxFiles < 1 {
+			return fmt.Errorf("Invalid log max files: %d", o.logMaxFiles)
+		}
 	}
 
 	return nil
 }
 
+// parseHealth validates the health check options.
+func (o *Options) parseHealth() (err error) {
+	if o.healthCmd == "" {
+		return nil
+	}
+	if o.healthArgv, err = parseRun(o.healthCmd); err != nil {
+		return err
+	}
+	if o.healthInterval <= 0 || o.healthTimeout <= 0 || o.healthStartPeriod < 0 {
+		return fmt.Errorf("Invalid health check interval, timeout or start period")
+	}
+	if o.healthRetries < 1 {
+		return fmt.Errorf("Invalid health retries: %d", o.healthRetries)
+	}
+	switch o.healthOnUnhealthy {
+	case unhealthyNone, unhealthyRestart, unhealthyStop:
+		return nil
+	}
+	return fmt.Errorf("Invalid action on unhealthy: %s", o.healthOnUnhealthy)
+}
+
+// parseJoinNs validates the namespace options.
+func (o *Options) parseJoinNs() error {
+	for _, typ := range joinableNs {
+		v := *o.nsFlags[typ]
+		if v == "" {
+			continue
+		}
+		name := strings.TrimPrefix(v, "container:")
+		if name == v || name == "" {
+			return fmt.Errorf("Invalid %s namespace: %s", typ, v)
+		}
+		if name == o.name {
+			return fmt.Errorf("Container %s can't join its own %s namespace", name, typ)
+		}
+		if o.joinNs == nil {
+			o.joinNs = make(map[string]string)
+		}
+		o.joinNs[typ] = name
+	}
+
+	// The hostname belongs to the joined container.
+	if o.joinNs["uts"] != "" && o.hostname != "" {
+		return fmt.Errorf("Can't set hostname when joining the uts namespace")
+	}
+	return nil
+}
+
+// parsePod validates the pod options, the members of pod join the pod
+// namespaces.
+func (o *Options) parsePod() error {
+	if o.podInfra {
+		if o.root != "" || o.pod != "" || len(o.joinNs) != 0 || len(o.argv) != 0 {
+			return fmt.Errorf("The infra container of pod has no root, command or pod")
+		}
+		return nil
+	}
+	if o.pod == "" {
+		return nil
+	}
+	if o.pod == o.name {
+		return fmt.Errorf("Container %s can't be in its own pod", o.name)
+	}
+
+	if o.joinNs == nil {
+		o.joinNs = make(map[string]string)
+	}
+	for _, typ := range podNs {
+		if name := o.joinNs[typ]; name != "" && name != o.pod {
+			return fmt.Errorf("Container in pod %s can't join the %s namespace of %s", o.pod, typ, name)
+		}
+		o.joinNs[typ] = o.pod
+	}
+	if o.hostname != "" {
+		return fmt.Errorf("Can't set hostname of container in pod, it's the pod's")
+	}
+	return nil
+}
+
 func (o *Options) IsExec() bool {
-	return o.run == "" && o.exec != ""
+	return o.run == "" && o.exec.set
+}
+
+// execFlag is the value of --exec, it could be used as a bool flag with
+// the command given after "--", or with a quoted command string.
+type execFlag struct {
+	set bool
+	cmd string
+}
+
+func (f *execFlag) String() string {
+	return f.cmd
+}
+
+func (f *execFlag) Set(v string) error {
+	f.set = true
+	if v != "true" {
+		f.cmd = v
+	}
+	return nil
+}
+
+func (f *execFlag) IsBoolFlag() bool {
+	return true
 }
 
-func parseRun(run string) (string, []string, error) {
-	args := strings.Fields(run)
+// envFlag is the repeatable -e, a KEY without value is taken from our
+// environment, it's ignored if we don't have it.
+type envFlag []string
+
+func (f *envFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *envFlag) Set(v string) error {
+	key := v
+	if i := strings.IndexByte(v, '='); i >= 0 {
+		key = v[:i]
+	} else if value, ok := os.LookupEnv(key); ok {
+		v = key + "=" + value
+	} else {
+		return nil
+	}
+	if key == "" {
+		return fmt.Errorf("Invalid environment variable: %s", v)
+	}
+	*f = append(*f, v)
+	return nil
+}
+
+// afterDashes reports whether the trailing arguments of the command line
+// follow "--".
+func afterDashes(cmdline, args []string) bool {
+	i := len(cmdline) - len(args) - 1
+	return i >= 0 && cmdline[i] == "--"
+}
+
+func parseRun(run string) ([]string, error) {
+	args, err := splitArgs(run)
+	if err != nil {
+		return nil, err
+	}
 	if len(args) == 0 {
-		return "", nil, ErrOptNoRun
+		return nil, ErrOptNoRun
+	}
+	return args, nil
+}
+
+// splitArgs splits a command line into words like the shell does, single
+// and double quotes group words, a backslash escapes the next character.
+func splitArgs(s string) ([]string, error) {
+	var (
+		args   []string
+		word   []rune
+		inWord bool
+		quote  rune
+		escape bool
+	)
+
+	for _, r := range s {
+		switch {
+		case escape:
+			word = append(word, r)
+			escape = false
+
+		case r == '\\' && quote != '\'':
+			escape = true
+			inWord = true
+
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word = append(word, r)
+			}
+
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+
+		case strings.ContainsRune(" \t\r\n", r):
+			if inWord {
+				args = append(args, string(word))
+				word = word[:0]
+				inWord = false
+			}
+
+		default:
+			word = append(word, r)
+			inWord = true
+		}
+	}
+
+	if escape || quote != 0 {
+		return nil, fmt.Errorf("Unterminated quote or escape in %q", s)
+	}
+	if inWord {
+		args = append(args, string(word))
 	}
-	return args[0], args, nil
+	return args, nil
 }
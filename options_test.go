@@ -0,0 +1,59 @@
+package tinybox
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRun(t *testing.T) {
+	tests := []struct {
+		run  string
+		argv []string
+		err  bool
+	}{
+		{run: "ls -l /", argv: []string{"ls", "-l", "/"}},
+		{run: "  ls \t -l\n", argv: []string{"ls", "-l"}},
+		{run: `sh -c 'echo "a b"'`, argv: []string{"sh", "-c", `echo "a b"`}},
+		{run: `echo "it's" 'a\b'`, argv: []string{"echo", "it's", `a\b`}},
+		{run: `echo a\ b "c\"d"`, argv: []string{"echo", "a b", `c"d`}},
+		{run: `echo "" ''`, argv: []string{"echo", "", ""}},
+		{run: `echo a"b c"d`, argv: []string{"echo", "ab cd"}},
+		{run: `echo 'a b`, err: true},
+		{run: `echo "a b`, err: true},
+		{run: `echo a\`, err: true},
+		{run: "", err: true},
+		{run: "   ", err: true},
+	}
+
+	for _, tt := range tests {
+		argv, err := parseRun(tt.run)
+		if (err != nil) != tt.err {
+			t.Errorf("parseRun(%q) error = %v, want error %v", tt.run, err, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(argv, tt.argv) {
+			t.Errorf("parseRun(%q) = %q, want %q", tt.run, argv, tt.argv)
+		}
+	}
+}
+
+func TestAfterDashes(t *testing.T) {
+	tests := []struct {
+		cmdline []string
+		args    []string
+		want    bool
+	}{
+		{[]string{"tinybox", "--exec", "--", "ls -l"}, []string{"ls -l"}, true},
+		{[]string{"tinybox", "--exec", "--", "ls", "-l"}, []string{"ls", "-l"}, true},
+		{[]string{"tinybox", "--exec", "ls -l"}, []string{"ls -l"}, false},
+		{[]string{"tinybox", "--exec", "ls", "-l"}, []string{"ls", "-l"}, false},
+		{[]string{"tinybox", "--", "--"}, []string{"--"}, true},
+		{[]string{"ls"}, []string{"ls"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := afterDashes(tt.cmdline, tt.args); got != tt.want {
+			t.Errorf("afterDashes(%q, %q) = %v, want %v", tt.cmdline, tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package tinybox
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// A pod is a group of containers sharing the net, ipc and uts namespaces of
+// its infra container, which is named as the pod. The cgroups of the infra
+// container are the parents of the members' ones, so its limits are the
+// limits of the whole pod.
+
+// podNs are the namespaces created by the infra container and joined by the
+// members.
+var podNs = []string{"net", "ipc", "uts"}
+
+// podCgPrefix returns the cgroup prefix of the members of pod.
+func podCgPrefix(pod string) string {
+	return "tinybox/" + pod
+}
+
+// podMembers returns the containers in pod, the infra one isn't included.
+func podMembers(pod string) ([]*Container, error) {
+	cs, err := Containers()
+	if err != nil {
+		return nil, err
+	}
+
+	var members []*Container
+	for _, c := range cs {
+		if c.Pod == pod {
+			members = append(members, c)
+		}
+	}
+	return members, nil
+}
+
+// pause is the init process of the infra container, it only holds the
+// namespaces of pod until it's stopped.
+func (p *initProcess) pause(c *Container) error {
+	if err := loopbackUp(); err != nil {
+		return fmt.Errorf("Set up loopback error: %v", err)
+	}
+
+	hostname := c.Hostname
+	if hostname == "" {
+		hostname = c.Name
+	}
+	if err := syscall.Sethostname([]byte(hostname)); err != nil {
+		return fmt.Errorf("Set hostname error: %v", err)
+	}
+	syscall.Close(p.execFd)
+
+	sc := make(chan os.Signal, 1)
+	signal.Notify(sc, syscall.SIGTERM, syscall.SIGINT)
+
+	log.Printf("Pod %s infra process is ready \n", c.Name)
+	sig := <-sc
+	log.Printf("Pod %s infra process exits by %s \n", c.Name, sig)
+	return nil
+}
+
+// ifreqFlags is the struct ifreq of the SIOCGIFFLAGS and SIOCSIFFLAGS ioctls.
+type ifreqFlags struct {
+	name  [syscall.IFNAMSIZ]byte
+	flags uint16
+	_     [24 - 2]byte
+}
+
+// loopbackUp brings up the lo interface of the new net namespace, so the
+// members of pod could talk through localhost.
+func loopbackUp() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	var ifr ifreqFlags
+	copy(ifr.name[:], "lo")
+
+	if err := ioctl(uintptr(fd), syscall.SIOCGIFFLAGS, uintptr(unsafe.Pointer(&ifr))); err != nil {
+		return err
+	}
+	ifr.flags |= syscall.IFF_UP
+	return ioctl(uintptr(fd), syscall.SIOCSIFFLAGS, uintptr(unsafe.Pointer(&ifr)))
+}
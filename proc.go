@@ -0,0 +1,179 @@
+package tinybox
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// procStat reads the fields of /proc/<pid>/stat after the command name, the
+// first one is the state, which is the third field of the file.
+func procStat(pid int) ([]string, error) {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	// The command name could have spaces and ')', it ends at the last ')'.
+	s := string(b)
+	i := strings.LastIndexByte(s, ')')
+	if i < 0 {
+		return nil, fmt.Errorf("Invalid stat of process %d", pid)
+	}
+	return strings.Fields(s[i+1:]), nil
+}
+
+// procStartTime returns the start time of process, in clock ticks after
+// system boot.
+func procStartTime(pid int) (uint64, error) {
+	fields, err := procStat(pid)
+	if err != nil {
+		return 0, err
+	}
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("Invalid stat of process %d", pid)
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
+
+// processStarted reports whether the process is alive and it's the same one
+// started at the start time, not a recycled pid.
+func processStarted(pid int, start uint64) bool {
+	if pid <= 0 {
+		return false
+	}
+	t, err := procStartTime(pid)
+	return err == nil && t == start
+}
+
+// procEnviron returns the environment of process.
+func procEnviron(pid int) ([]string, error) {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/environ", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	var env []string
+	for _, kv := range strings.Split(string(b), "\x00") {
+		if kv != "" {
+			env = append(env, kv)
+		}
+	}
+	return env, nil
+}
+
+// procPpid returns the parent pid of process.
+func procPpid(pid int) (int, error) {
+	fields, err := procStat(pid)
+	if err != nil {
+		return 0, err
+	}
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("Invalid stat of process %d", pid)
+	}
+	return strconv.Atoi(fields[1])
+}
+
+// procCmdline returns the argv of process.
+func procCmdline(pid int) ([]string, error) {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimRight(string(b), "\x00"), "\x00"), nil
+}
+
+// procNamespaces returns the inode numbers of namespaces of process, keyed
+// by the names in /proc/<pid>/ns.
+func procNamespaces(pid int) (map[string]uint64, error) {
+	dir := fmt.Sprintf("/proc/%d/ns", pid)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ns := make(map[string]uint64, len(infos))
+	for _, info := range infos {
+		link, err := os.Readlink(filepath.Join(dir, info.Name()))
+		if err != nil {
+			continue
+		}
+
+		// The link is like "net:[4026531992]".
+		i, j := strings.IndexByte(link, '['), strings.IndexByte(link, ']')
+		if i < 0 || j < i {
+			continue
+		}
+		if ino, err := strconv.ParseUint(link[i+1:j], 10, 64); err == nil {
+			ns[info.Name()] = ino
+		}
+	}
+	return ns, nil
+}
+
+// mountInfo is a line of /proc/<pid>/mountinfo.
+type mountInfo struct {
+	MountPoint string `json:"mountpoint"`
+	Root       string `json:"root"`
+	FsType     string `json:"fstype"`
+	Source     string `json:"source"`
+	Options    string `json:"options"`
+}
+
+// procMounts returns the mounts in the mount namespace of process.
+func procMounts(pid int) ([]mountInfo, error) {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/mountinfo", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	var mounts []mountInfo
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+
+		// The optional fields end with "-", the fstype and source follow it.
+		sep := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 0 || sep+2 >= len(fields) {
+			continue
+		}
+
+		mounts = append(mounts, mountInfo{
+			Root:       unescapeMount(fields[3]),
+			MountPoint: unescapeMount(fields[4]),
+			Options:    fields[5],
+			FsType:     fields[sep+1],
+			Source:     unescapeMount(fields[sep+2]),
+		})
+	}
+	return mounts, nil
+}
+
+// unescapeMount decodes the octal escapes of the paths in mountinfo, like
+// \040 for the space.
+func unescapeMount(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b = append(b, byte(n))
+				i += 3
+				continue
+			}
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
+}
@@ -0,0 +1,26 @@
+package tinybox
+
+import "testing"
+
+func TestUnescapeMount(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{`/tmp/tinybox`, `/tmp/tinybox`},
+		{`/tmp/tb\040home`, `/tmp/tb home`},
+		{`/tmp/a\011b\012c`, "/tmp/a\tb\nc"},
+		{`/tmp/back\134slash`, `/tmp/back\slash`},
+		{`/tmp/\134040`, `/tmp/\040`},
+		{`/tmp/trailing\`, `/tmp/trailing\`},
+		{`/tmp/short\04`, `/tmp/short\04`},
+		{`/tmp/bad\09x`, `/tmp/bad\09x`},
+		{`\040`, ` `},
+	}
+
+	for _, tt := range tests {
+		if got := unescapeMount(tt.s); got != tt.want {
+			t.Errorf("unescapeMount(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
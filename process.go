@@ -1,7 +1,19 @@
 package tinybox
 
-import ()
+import (
+	"fmt"
+)
 
 type process interface {
 	Start(*Container) error
 }
+
+// ExitError is returned by Start when the tinybox command should exit with
+// the status of the process it ran.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
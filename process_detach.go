@@ -0,0 +1,122 @@
+package tinybox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// The detached master is started by a double fork, the stage is passed
+// through __TINYBOX_MONITOR__ env.
+const (
+	stageDaemon  = "daemon"  // setsid, then start the monitor and exit
+	stageMonitor = "monitor" // the long-lived master process
+)
+
+// readyInfo is sent by the monitor to tinybox once the container started.
+type readyInfo struct {
+	Pid int `json:"pid"`
+}
+
+// detach starts the monitor of container in the background, it returns when
+// the container started or the monitor failed.
+func (p *masterProcess) detach(c *Container) error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		return err
+	}
+	defer null.Close()
+
+	out, err := os.OpenFile(c.MonitorLogFile(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	cmd := &exec.Cmd{
+		Dir:         "/",
+		Path:        "/proc/self/exe",
+		Args:        c.cmdline,
+		Stdin:       null,
+		Stdout:      out,
+		Stderr:      out,
+		ExtraFiles:  []*os.File{w},
+		SysProcAttr: &syscall.SysProcAttr{Setsid: true},
+	}
+	cmd.Env = append(cmd.Env, os.Environ()...)
+	cmd.Env = append(cmd.Env, "__TINYBOX_MONITOR__="+stageDaemon)
+	cmd.Env = append(cmd.Env, fmt.Sprintf("__TINYBOX_READY__=%d", 2+len(cmd.ExtraFiles)))
+
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return err
+	}
+	cmd.Wait()
+
+	var ready readyInfo
+	if err := json.NewDecoder(r).Decode(&ready); err != nil {
+		return fmt.Errorf("Container %s failed to start, see %s", c.Name, filepath.Join(c.Dir, "log"))
+	}
+
+	fmt.Printf("%s %d\n", c.Name, ready.Pid)
+	return nil
+}
+
+// daemonize is the first fork, it's the session leader. The monitor is
+// started by it, so the monitor can't acquire a controlling terminal.
+func (p *masterProcess) daemonize(c *Container) error {
+	ready, err := readyFile()
+	if err != nil {
+		return err
+	}
+	defer ready.Close()
+
+	cmd := &exec.Cmd{
+		Dir:        "/",
+		Path:       "/proc/self/exe",
+		Args:       c.cmdline,
+		Stdin:      os.Stdin,
+		Stdout:     os.Stdout,
+		Stderr:     os.Stderr,
+		ExtraFiles: []*os.File{ready},
+	}
+	cmd.Env = append(cmd.Env, os.Environ()...)
+	cmd.Env = append(cmd.Env, "__TINYBOX_MONITOR__="+stageMonitor)
+	cmd.Env = append(cmd.Env, fmt.Sprintf("__TINYBOX_READY__=%d", 2+len(cmd.ExtraFiles)))
+
+	return cmd.Start()
+}
+
+// ready tells tinybox the container started, if it's a detached monitor.
+func (p *masterProcess) ready(c *Container) {
+	if p.readyf == nil {
+		return
+	}
+	json.NewEncoder(p.readyf).Encode(&readyInfo{Pid: c.Pid})
+	p.readyf.Close()
+	p.readyf = nil
+}
+
+// readyFile opens the pipe to tinybox passed by __TINYBOX_READY__, the env
+// is removed so it's not seen by the container.
+func readyFile() (*os.File, error) {
+	fd, err := strconv.Atoi(os.Getenv("__TINYBOX_READY__"))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid __TINYBOX_READY__: %v", err)
+	}
+	os.Unsetenv("__TINYBOX_READY__")
+
+	syscall.CloseOnExec(fd)
+	return os.NewFile(uintptr(fd), "ready"), nil
+}
@@ -0,0 +1,238 @@
+package tinybox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/skoo87/tinybox/pipe"
+)
+
+// maxExecOutput is the bytes of output kept by runExec.
+const maxExecOutput = 64 * 1024
+
+// startExec starts the setns process which joins the namespaces of container
+// and forks the exec process, the stdio of the exec process are the given
+// files. It returns the exec process, which is our child, and the socket to
+// it, the caller should close the socket.
+func startExec(c *Container, config *execConfig, stdio [3]*os.File) (process *os.Process, sock *os.File, err error) {
+	parent, child, err := pipe.New()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer child.Close()
+	defer func() {
+		if err != nil {
+			parent.Close()
+		}
+	}()
+
+	// The exec process waits the lock, until we found it.
+	lock, err := Flock(c.LockFile())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer Funlock(lock)
+
+	cmd := &exec.Cmd{
+		Dir:         "/",
+		Path:        "/proc/self/exe",
+		Args:        []string{"setns", c.Name},
+		Stdin:       stdio[0],
+		Stdout:      stdio[1],
+		Stderr:      stdio[2],
+		SysProcAttr: &syscall.SysProcAttr{},
+	}
+	cmd.ExtraFiles = append(cmd.ExtraFiles, child)
+
+	namespaces, err := execNamespaces(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cmd.Env = append(cmd.Env, os.Environ()...)
+	cmd.Env = append(cmd.Env, fmt.Sprintf("__TINYBOX_PIPE__=%d", 2+len(cmd.ExtraFiles)))
+
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("Start setns process error: %v", err)
+	}
+	child.Close()
+
+	// The setns process joins the namespaces before it reports the pid of
+	// exec process, or the error.
+	if _, err := io.WriteString(parent, namespaces); err != nil {
+		cmd.Process.Kill()
+		cmd.Process.Wait()
+		return nil, nil, fmt.Errorf("Send namespaces error: %v", err)
+	}
+
+	pid := struct {
+		Pid   int
+		Error string
+	}{}
+	if err := json.NewDecoder(parent).Decode(&pid); err != nil {
+		cmd.Process.Wait()
+		return nil, nil, fmt.Errorf("Read exec process pid error: %v", err)
+	}
+	if pid.Error != "" {
+		cmd.Process.Wait()
+		return nil, nil, fmt.Errorf("Join container %s error: %s", c.Name, pid.Error)
+	}
+
+	if debug {
+		log.Printf("Exec process pid: %d \n", pid.Pid)
+	}
+
+	if process, err = os.FindProcess(pid.Pid); err != nil {
+		return nil, nil, err
+	}
+
+	// The exec process waits the config, so it runs the command in the
+	// cgroups of container and the limits apply.
+	if err = joinCgroups(c, pid.Pid); err != nil {
+		process.Kill()
+		process.Wait()
+		return nil, nil, err
+	}
+
+	// The environment of init process is the base of the exec one.
+	config.Env = execEnv(c, config.Env)
+
+	// Send the config to the exec process.
+	if err = json.NewEncoder(parent).Encode(config); err != nil {
+		process.Kill()
+		process.Wait()
+		return nil, nil, err
+	}
+
+	status, err := cmd.Process.Wait()
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Printf("setns process: %d exit \n", status.Pid())
+
+	return process, parent, nil
+}
+
+// execNsOrder is the order which the setns process joins the namespaces in,
+// the user namespace is the first, it grants the privileges in the others.
+var execNsOrder = []string{"user", "ipc", "uts", "net", "cgroup", "time", "pid", "mnt"}
+
+// execNamespaces returns the namespace files of container which the setns
+// process joins, as "<type> <path>" lines ended by an empty line. The ones
+// persisted by --persist-ns are preferred, the setns process skips the ones
+// it's already in. The others are taken from the init process, they're gone
+// with it, so the exec process after init exited only joins the persisted.
+func execNamespaces(c *Container) (string, error) {
+	running := processStarted(c.Pid, c.StartTime)
+	persisted := false
+
+	var b strings.Builder
+	for _, typ := range execNsOrder {
+		path := filepath.Join(c.NsDir(), typ)
+		if c.PersistNs && isNsFile(path) {
+			persisted = true
+		} else if running {
+			path = fmt.Sprintf("/proc/%d/ns/%s", c.Pid, typ)
+		} else {
+			continue
+		}
+		// Not supported by the kernel.
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		fmt.Fprintf(&b, "%s %s\n", typ, path)
+	}
+	if !running && !persisted {
+		return "", fmt.Errorf("Container %s is not running", c.Name)
+	}
+	b.WriteString("\n")
+	return b.String(), nil
+}
+
+// execEnv returns the environment of exec process, the env of init process
+// with the given variables, the tinybox internal ones are dropped.
+func execEnv(c *Container, env []string) []string {
+	base, err := procEnviron(c.Pid)
+	if err != nil {
+		log.Printf("Read environment of init process error: %v \n", err)
+	}
+
+	var merged []string
+	index := make(map[string]int)
+	for _, kv := range append(base, env...) {
+		key := kv
+		if i := strings.IndexByte(kv, '='); i >= 0 {
+			key = kv[:i]
+		}
+		if strings.HasPrefix(key, "__TINYBOX_") {
+			continue
+		}
+		if i, ok := index[key]; ok {
+			merged[i] = kv
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, kv)
+	}
+	return merged
+}
+
+// runExec runs argv in container without stdin, and returns its exit code and
+// the combined output. The exec process is killed after timeout.
+func runExec(c *Container, argv []string, timeout time.Duration) (int, string, error) {
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		return 0, "", err
+	}
+	defer null.Close()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, "", err
+	}
+	defer r.Close()
+
+	process, sock, err := startExec(c, &execConfig{Args: argv}, [3]*os.File{null, w, w})
+	w.Close()
+	if err != nil {
+		return 0, "", err
+	}
+	sock.Close()
+
+	var output bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		io.Copy(&output, io.LimitReader(r, maxExecOutput))
+		io.Copy(io.Discard, r)
+		close(done)
+	}()
+
+	timer := time.AfterFunc(timeout, func() {
+		log.Printf("Exec process: %d timeout, kill it \n", process.Pid)
+		process.Kill()
+	})
+	status, err := process.Wait()
+	timer.Stop()
+	if err != nil {
+		return 0, "", err
+	}
+
+	// The children of exec process may keep the output open.
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		r.Close()
+		<-done
+	}
+
+	return ExitCode(status.Sys().(syscall.WaitStatus)), output.String(), nil
+}
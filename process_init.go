@@ -4,13 +4,20 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"strconv"
 	"syscall"
 )
 
 type initProcess struct {
+	execFd int // closed when the command is executed, see execPipe
 }
 
 func (p *initProcess) Start(c *Container) error {
+	if err := p.execPipe(); err != nil {
+		return err
+	}
+
 	if err := c.WaitJson(); err != nil {
 		return fmt.Errorf("Init process load container error: %v", err)
 	}
@@ -19,6 +26,10 @@ func (p *initProcess) Start(c *Container) error {
 		log.Printf("Container info: %+v \n", c)
 	}
 
+	if c.Infra {
+		return p.pause(c)
+	}
+
 	// Mount filesystem
 	if err := c.fsop.Mount(c); err != nil {
 		return err
@@ -31,7 +42,117 @@ func (p *initProcess) Start(c *Container) error {
 		}
 	}
 
+	// The namespaces which can't be created by clone, the proc of container
+	// is mounted.
+	if err := c.nsop.Setup(c); err != nil {
+		return err
+	}
+
+	if c.Tty {
+		if err := p.console(c); err != nil {
+			return err
+		}
+	}
+
 	log.Printf("Run init process: %s, %v", c.Path, c.Argv)
 
+	if c.Init {
+		return p.supervise(c)
+	}
+
 	return syscall.Exec(c.Path, c.Argv, os.Environ())
 }
+
+// supervise keeps tinybox as pid 1 of the container, it forks the command,
+// forwards signals to it and reaps every zombie until the command exits.
+func (p *initProcess) supervise(c *Container) error {
+	sc := make(chan os.Signal, 32)
+	signal.Notify(sc)
+
+	attr := &os.ProcAttr{
+		Env:   os.Environ(),
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
+	}
+	if c.Tty {
+		// The command owns the foreground of the terminal, so the signals
+		// from the terminal aren't delivered to it twice.
+		attr.Sys = &syscall.SysProcAttr{Foreground: true, Ctty: 0}
+	}
+
+	child, err := os.StartProcess(c.Path, c.Argv, attr)
+	if err != nil {
+		return err
+	}
+	syscall.Close(p.execFd)
+
+	for sig := range sc {
+		switch sig {
+		case syscall.SIGCHLD:
+			if code, exited := p.reap(child.Pid); exited {
+				log.Printf("Command process: %d exit with %d \n", child.Pid, code)
+				return &ExitError{Code: code}
+			}
+
+		case syscall.SIGURG:
+			// Used by the go runtime for preemption, not for us.
+
+		default:
+			if debug {
+				log.Printf("Forward signal %s to %d \n", sig, child.Pid)
+			}
+			child.Signal(sig)
+		}
+	}
+
+	return nil
+}
+
+// reap waits all exited children, it reports the exit code of the command
+// process if it's one of them.
+func (p *initProcess) reap(pid int) (code int, exited bool) {
+	for {
+		var ws syscall.WaitStatus
+
+		wpid, err := syscall.Wait4(-1, &ws, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || wpid <= 0 {
+			return
+		}
+
+		if wpid == pid {
+			code, exited = ExitCode(ws), true
+		}
+	}
+}
+
+// execPipe takes the pipe which tells the master process the command is
+// executed, it's closed on exec, so the master gets EOF then, or when we exit
+// on an error before it.
+func (p *initProcess) execPipe() error {
+	fd, err := strconv.Atoi(os.Getenv("__TINYBOX_EXEC__"))
+	if err != nil {
+		return fmt.Errorf("Invalid __TINYBOX_EXEC__: %v", err)
+	}
+	os.Unsetenv("__TINYBOX_EXEC__")
+
+	syscall.CloseOnExec(fd)
+	p.execFd = fd
+	return nil
+}
+
+// console creates the terminal from the devpts of container, sends its
+// master side to the master process and makes the slave side our stdio.
+func (p *initProcess) console(c *Container) error {
+	fd, err := strconv.Atoi(os.Getenv("__TINYBOX_CONSOLE__"))
+	if err != nil {
+		return fmt.Errorf("Invalid __TINYBOX_CONSOLE__: %v", err)
+	}
+	os.Unsetenv("__TINYBOX_CONSOLE__")
+
+	sock := os.NewFile(uintptr(fd), "console")
+	defer sock.Close()
+
+	return openConsole(sock)
+}
@@ -1,13 +1,15 @@
 package tinybox
 
 import (
-	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"math"
 	"os"
 	"os/exec"
 	"os/signal"
+	"runtime"
 	"sync"
 	"syscall"
 	"time"
@@ -16,10 +18,19 @@ import (
 )
 
 const (
-	evStop  = "stop"
-	evChild = "child"
-	evExec  = "exec"
-	evInfo  = "info"
+	evStop    = "stop"
+	evChild   = "child"
+	evExec    = "exec"
+	evInfo    = "info"
+	evSignal  = "signal"
+	evPause   = "pause"
+	evResume  = "resume"
+	evStats   = "stats"
+	evUpdate  = "update"
+	evOOM     = "oom"
+	evRestart = "restart"
+	evStarted = "started"
+	evHealth  = "health"
 )
 
 type masterProcess struct {
@@ -29,90 +40,98 @@ type masterProcess struct {
 	sigs map[os.Signal]func(os.Signal, chan event)
 	stop chan struct{}
 	wg   sync.WaitGroup
+
+	stopping bool     // a stop is in progress, waiting the stop timeout
+	console  *console // the terminal of container, nil without --tty
+	readyf   *os.File // the pipe to tinybox, if it's a detached monitor
+
+	attach     *attachServer  // serves the stdio of a detached container
+	log        *containerLog  // captures the output of container
+	childFiles []*os.File     // closed after the init process started
+	iowg       sync.WaitGroup // the copying of container's output
+	control    *controlServer // the control socket of container
+	oom        *oomWatcher    // notified of the oom events of container
+	oomKills   int            // the oom kills of cgroup when init started
+	oomEvents  uint64         // the oom events when init started
+	stdin      *os.File       // the input of init process from attach
+
+	restarting   bool          // waiting to restart the init process
+	starting     bool          // the restarted init process is being started
+	snapshot     *Container    // the container replied by Info while starting
+	deferred     []event       // the events handled after the start
+	forceRestart bool          // restart the init process regardless of the policy
+	backoff      time.Duration // the last delay of restarting
 }
 
 func master() *masterProcess {
 	return &masterProcess{
 		ec: make(chan event, 10),
 		sigs: map[os.Signal]func(os.Signal, chan event){
-			syscall.SIGINT:  stopHandle,
-			syscall.SIGTERM: stopHandle,
+			syscall.SIGINT:   stopHandle,
+			syscall.SIGTERM:  forwardHandle,
+			syscall.SIGHUP:   forwardHandle,
+			syscall.SIGUSR1:  forwardHandle,
+			syscall.SIGUSR2:  forwardHandle,
+			syscall.SIGWINCH: forwardHandle,
+			syscall.SIGQUIT:  forwardHandle,
 		},
 		stop: make(chan struct{}),
 	}
 }
 
 func (p *masterProcess) eStart(c *Container) error {
-	parent, child, err := pipe.New()
-	if err != nil {
-		return err
-	}
-	defer parent.Close()
-	defer child.Close()
-
-	// lock file
-	lock, err := Flock(c.LockFile())
+	null, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
 	if err != nil {
 		return err
 	}
-
-	cmd := &exec.Cmd{
-		Dir:    "/",
-		Path:   "/proc/self/exe",
-		Args:   []string{"setns", c.Name},
-		Stdout: os.Stdout,
-		Stderr: os.Stderr,
-		Stdin:  os.Stdin,
-	}
-	if cmd.SysProcAttr == nil {
-		cmd.SysProcAttr = &syscall.SysProcAttr{}
-	}
-	cmd.ExtraFiles = append(cmd.ExtraFiles, child)
-
-	cmd.Env = append(cmd.Env, os.Environ()...)
-	cmd.Env = append(cmd.Env, fmt.Sprintf("__TINYBOX_INIT_PID__=%d", c.Pid))
-	cmd.Env = append(cmd.Env, fmt.Sprintf("__TINYBOX_PIPE__=%d", 2+len(cmd.ExtraFiles)))
-	cmd.Env = append(cmd.Env, fmt.Sprintf("__TINYBOX_CMD__=%s", c.Path))
-
-	if err := cmd.Start(); err != nil {
-		Funlock(lock)
-		return fmt.Errorf("Start setns process error: %v", err)
+	defer null.Close()
+
+	// The stdin is closed without -i, the detached one has no stdio.
+	stdio := [3]*os.File{null, os.Stdout, os.Stderr}
+	if c.Detach {
+		stdio = [3]*os.File{null, null, null}
+	} else if c.stdin {
+		stdio[0] = os.Stdin
 	}
 
-	pid := struct {
-		Pid int
-	}{}
-	if err := json.NewDecoder(parent).Decode(&pid); err != nil {
-		Funlock(lock)
+	process, sock, err := startExec(c, c.exec, stdio)
+	if err != nil {
 		return err
 	}
+	defer sock.Close()
 
-	if debug {
-		log.Printf("Exec process pid: %d \n", pid.Pid)
+	if c.Detach {
+		fmt.Println(process.Pid)
+		process.Release()
+		return nil
 	}
 
-	if status, err := cmd.Process.Wait(); err != nil {
-		Funlock(lock)
-		return err
-	} else {
-		log.Printf("setns process: %d exit \n", status.Pid())
+	if c.Tty {
+		ptm, err := recvFd(sock)
+		if err != nil {
+			process.Kill()
+			return fmt.Errorf("Receive console error: %v", err)
+		}
+		var in io.Reader
+		if c.stdin {
+			in = os.Stdin
+		}
+		cs := newConsole(ptm)
+		cs.proxy(in, os.Stdout)
+		defer cs.Close()
 	}
 
-	process, err := os.FindProcess(pid.Pid)
+	status, err := process.Wait()
 	if err != nil {
-		Funlock(lock)
 		return err
 	}
 
-	// unlock file
-	Funlock(lock)
+	code := ExitCode(status.Sys().(syscall.WaitStatus))
+	log.Printf("Exec process: %d exit with %d \n", status.Pid(), code)
 
-	if status, err := process.Wait(); err != nil {
-		return err
-	} else {
-		log.Printf("Exec process: %d exit \n", status.Pid())
+	if code != 0 {
+		return &ExitError{Code: code}
 	}
-
 	return nil
 }
 
@@ -121,6 +140,24 @@ func (p *masterProcess) Start(c *Container) error {
 		return p.eStart(c)
 	}
 
+	switch os.Getenv("__TINYBOX_MONITOR__") {
+	case stageDaemon:
+		return p.daemonize(c)
+
+	case stageMonitor:
+		os.Unsetenv("__TINYBOX_MONITOR__")
+
+		var err error
+		if p.readyf, err = readyFile(); err != nil {
+			return err
+		}
+
+	default:
+		if c.Detach {
+			return p.detach(c)
+		}
+	}
+
 	p.wg.Add(1)
 	go func() {
 		defer p.wg.Done()
@@ -129,6 +166,53 @@ func (p *masterProcess) Start(c *Container) error {
 		log.Println("Signal loop exited")
 	}()
 
+	if err := p.stdio(c); err != nil {
+		return err
+	}
+
+	c.MasterPid = os.Getpid()
+	if err := p.startInit(c); err != nil {
+		if p.cmd.Process == nil {
+			return err
+		}
+		// The started init process is killed and not restarted.
+		log.Println(err)
+		p.stopping = true
+		syscall.Kill(c.Pid, syscall.SIGKILL)
+		p.loop(c)
+		return p.wait(c)
+	}
+
+	// write container's info into disk
+	if err := c.save(); err != nil {
+		log.Println(err)
+	}
+
+	var err error
+	if p.control, err = newControlServer(p, c.ControlSocket()); err != nil {
+		log.Println(err)
+	}
+
+	if c.Healthcheck != nil {
+		p.wg.Add(1)
+		go func(cfg *HealthConfig) {
+			defer p.wg.Done()
+
+			p.healthCheck(cfg)
+			log.Println("Health check exited")
+		}(c.Healthcheck)
+	}
+
+	p.ready(c)
+
+	// The container is owned by the event loop from now on.
+	p.loop(c)
+
+	return p.wait(c)
+}
+
+// loop starts the event loop, it runs until the init process exited for good.
+func (p *masterProcess) loop(c *Container) {
 	p.wg.Add(1)
 	go func() {
 		defer p.wg.Done()
@@ -136,7 +220,33 @@ func (p *masterProcess) Start(c *Container) error {
 		p.events(c)
 		log.Println("Event loop exited")
 	}()
+}
+
+// startCmd starts the init process in the namespaces it joins. It's forked
+// from a thread switched into them, which runs a goroutine of its own and is
+// never unlocked, so the thread is thrown away when the goroutine exits and
+// no other goroutine runs in the namespaces.
+func (p *masterProcess) startCmd(c *Container) error {
+	if len(c.JoinNs) == 0 {
+		return p.cmd.Start()
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		if err := c.nsop.Join(c); err != nil {
+			errc <- err
+			return
+		}
+		errc <- p.cmd.Start()
+	}()
+	return <-errc
+}
 
+// startInit starts a new init process, joins it into the cgroups and sends
+// it the container info. Its exit is sent to the event loop as evChild, so a
+// started one which fails is killed by the caller.
+func (p *masterProcess) startInit(c *Container) error {
 	p.cmd = &exec.Cmd{
 		Dir:         c.Rootfs,
 		Path:        "/proc/self/exe",
@@ -149,59 +259,423 @@ func (p *masterProcess) Start(c *Container) error {
 	p.cmd.SysProcAttr.Cloneflags = c.nsop.Cloneflags(c)
 
 	p.cmd.Env = append(p.cmd.Env, os.Environ()...)
+	if c.TimeOffsets != nil && c.Rootfs != "" {
+		p.cmd.Env = append(p.cmd.Env, "__TINYBOX_TIME_OFFSETS__="+c.TimeOffsets.String())
+	}
+
+	// The init process closes the pipe when it executes the command, the
+	// poststart hooks wait it.
+	execr, execw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer execr.Close()
+	defer execw.Close()
+
+	p.childFiles = append(p.childFiles, execw)
+	p.cmd.ExtraFiles = append(p.cmd.ExtraFiles, execw)
+	p.cmd.Env = append(p.cmd.Env, fmt.Sprintf("__TINYBOX_EXEC__=%d", 2+len(p.cmd.ExtraFiles)))
+
+	// The socket which the init process sends the terminal through.
+	var sock *os.File
+	if c.Tty {
+		parent, child, err := pipe.New()
+		if err != nil {
+			return err
+		}
+		defer parent.Close()
+		defer child.Close()
+
+		sock = parent
+		p.childFiles = append(p.childFiles, child)
+		p.cmd.ExtraFiles = append(p.cmd.ExtraFiles, child)
+		p.cmd.Env = append(p.cmd.Env, fmt.Sprintf("__TINYBOX_CONSOLE__=%d", 2+len(p.cmd.ExtraFiles)))
+	}
+
+	if err := p.initStdio(c); err != nil {
+		return err
+	}
+
+	err = p.startCmd(c)
+
+	// Only the init process keeps the child side, so we get EOF if it dies.
+	for _, f := range p.childFiles {
+		f.Close()
+	}
+	p.childFiles = nil
 
-	if err := p.cmd.Start(); err != nil {
+	if err != nil {
 		return err
 	}
 
 	// Save container pid.
 	c.Pid = p.cmd.Process.Pid
+	c.StartedAt = time.Now()
+	if c.StartTime, err = procStartTime(c.Pid); err != nil {
+		log.Println(err)
+	}
+
+	go func(cmd *exec.Cmd) {
+		cmd.Wait()
+		select {
+		case p.ec <- event{action: evChild, data: cmd}:
+		case <-p.stop:
+		}
+	}(p.cmd)
 
 	// Set cgroup before init process.
 	if err := p.cgroup(c); err != nil {
-		log.Println(err)
-		return p.failToWait(c)
+		return err
+	}
+
+	if p.oom == nil {
+		p.oom, err = watchOOM(c.cgop.Paths()[subsysMEM], func(n uint64) {
+			select {
+			case p.ec <- event{action: evOOM, data: n}:
+			case <-p.stop:
+			}
+		})
+		if err != nil {
+			log.Printf("Watch oom error: %v \n", err)
+		}
+	}
+	// Only the oom kills of this init process are counted by exited.
+	p.oomKills, p.oomEvents = oomKillCount(c.cgop.Paths()[subsysMEM]), p.oom.count()
+
+	// The hooks could set up the persisted namespaces, like the network.
+	if c.PersistNs {
+		if err := persistNamespaces(c); err != nil {
+			return err
+		}
+	}
+
+	if c.Hooks != nil {
+		if err := runHooks(c, "prestart", c.Hooks.Prestart, StatusCreated); err != nil {
+			return err
+		}
 	}
 
 	// Send info to container init process.
 	c.writePipe()
 
-	// write container's info into disk
-	info, err := json.Marshal(c)
-	if err != nil {
-		log.Println(err)
-	} else {
-		if err = ioutil.WriteFile(c.JsonFile(), info, 0644); err != nil {
+	if sock != nil {
+		ptm, err := recvFd(sock)
+		if err != nil {
+			return fmt.Errorf("Receive console error: %v", err)
+		}
+		p.console = newConsole(ptm)
+
+		if p.attach != nil {
+			p.attach.setInput(ptm, ptm)
+			p.console.proxy(nil, p.output(streamStdout))
+		} else {
+			p.console.proxy(os.Stdin, p.output(streamStdout))
+		}
+	}
+
+	// Wait the init process executed the command, or exited.
+	io.Copy(ioutil.Discard, execr)
+
+	if c.Hooks != nil {
+		if err := runHooks(c, "poststart", c.Hooks.Poststart, StatusRunning); err != nil {
 			log.Println(err)
 		}
 	}
 
-	return p.wait(c)
+	return nil
 }
 
-func (p *masterProcess) failToWait(c *Container) error {
-	syscall.Kill(c.Pid, syscall.SIGKILL)
-	return p.wait(c)
+// stdio opens the container log, and the attach socket which serves the
+// stdio of a detached container, otherwise it's the stdio of tinybox. They
+// are kept across the restarts of init process.
+func (p *masterProcess) stdio(c *Container) error {
+	var err error
+	if p.log, err = openContainerLog(c); err != nil {
+		return err
+	}
+
+	if c.Detach {
+		if p.attach, err = newAttachServer(c.AttachSocket()); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (p *masterProcess) wait(c *Container) error {
+// initStdio connects the stdio of a new init process, the output is always
+// captured into the container log.
+func (p *masterProcess) initStdio(c *Container) error {
+	// The output of terminal is connected when the console is received.
+	if c.Tty {
+		return nil
+	}
+
+	if p.attach != nil {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+		if p.stdin != nil {
+			p.stdin.Close()
+		}
+		p.stdin = w
+		p.childFiles = append(p.childFiles, r)
+		p.cmd.Stdin = r
+		p.attach.setInput(w, nil)
+	}
+
+	for stream, out := range map[byte]*io.Writer{streamStdout: &p.cmd.Stdout, streamStderr: &p.cmd.Stderr} {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+		p.childFiles = append(p.childFiles, w)
+		*out = w
+
+		p.iowg.Add(1)
+		go func(dst io.Writer, r *os.File) {
+			defer p.iowg.Done()
+			defer r.Close()
+			io.Copy(dst, r)
+		}(p.output(stream), r)
+	}
+
+	return nil
+}
+
+// output returns where the output stream of container goes.
+func (p *masterProcess) output(stream byte) io.Writer {
+	var w io.Writer
+	switch {
+	case p.attach != nil:
+		w = p.attach.writer(stream)
+	case stream == streamStderr:
+		w = os.Stderr
+	default:
+		w = os.Stdout
+	}
+
+	name := "stdout"
+	if stream == streamStderr {
+		name = "stderr"
+	}
+	return io.MultiWriter(w, p.log.stream(name))
+}
+
+// closeStdio waits a moment for the rest output of container, and closes
+// the attach socket and the container log.
+func (p *masterProcess) closeStdio(c *Container) {
+	done := make(chan struct{})
 	go func() {
-		p.cmd.Wait()
-		close(p.stop)
-		log.Println("Stop master process")
+		p.iowg.Wait()
+		close(done)
 	}()
 
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+	}
+
+	if p.attach != nil {
+		p.attach.Close()
+		os.Remove(c.AttachSocket())
+	}
+	if p.stdin != nil {
+		p.stdin.Close()
+	}
+	if p.log != nil {
+		p.log.Close()
+	}
+}
+
+// wait waits the init process exited for good, then cleans up container.
+func (p *masterProcess) wait(c *Container) error {
 	p.wg.Wait()
+
+	// The master with an exited init process is restarting it, until the
+	// control socket is closed.
+	if p.control != nil {
+		p.control.Close()
+	}
+
+	code := c.Exit.Code
+	if err := c.save(); err != nil {
+		log.Println(err)
+	}
+
+	// The attached clients read the exit state after disconnected.
+	p.closeStdio(c)
 	p.cleanup(c)
 
+	if code != 0 {
+		return &ExitError{Code: code}
+	}
 	return nil
 }
 
+// exited handles the exit of init process, it's restarted after a delay by
+// the restart policy, otherwise the master stops.
+func (p *masterProcess) exited(c *Container) {
+	if p.console != nil {
+		p.console.Close()
+		p.console = nil
+	}
+
+	// Record the exit status before the cgroups are removed.
+	code := p.exitState(c)
+
+	delay, ok := p.restartDelay(c, code)
+	if !ok {
+		p.finish()
+		return
+	}
+
+	log.Printf("Restart init process in %s \n", delay)
+	p.restarting = true
+	if err := c.save(); err != nil {
+		log.Println(err)
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		select {
+		case <-time.After(delay):
+			sendEvent(p.ec, event{action: evRestart})
+		case <-p.stop:
+		}
+	}()
+}
+
+// restart starts a new init process off the event loop, the hooks and the
+// init process could block it for long. The result is sent back as evStarted,
+// until then the container is owned by the start, see whileStarting.
+func (p *masterProcess) restart(c *Container) {
+	c.Restarts++
+	c.LastExit, c.Exit = c.Exit, nil
+	if c.Health != nil {
+		c.Health.Status = healthStarting
+		c.Health.FailingStreak = 0
+	}
+
+	info := *c
+	info.Restarting = true
+	p.snapshot = &info
+	p.starting = true
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		err := p.startInit(c)
+		select {
+		case p.ec <- event{action: evStarted, data: err}:
+		case <-p.stop:
+		}
+	}()
+}
+
+// started handles the result of restart, the master stops if the init
+// process can't be started. The events deferred during the start follow.
+func (p *masterProcess) started(c *Container, err error) {
+	p.starting = false
+	p.snapshot = nil
+
+	if err != nil {
+		log.Printf("Restart init process error: %v \n", err)
+		if p.cmd.Process == nil {
+			c.Exit = c.LastExit
+			p.finish()
+			return
+		}
+		p.stopping = true
+		syscall.Kill(c.Pid, syscall.SIGKILL)
+	}
+
+	if err := c.save(); err != nil {
+		log.Println(err)
+	}
+
+	deferred := p.deferred
+	p.deferred = nil
+	for _, ev := range deferred {
+		p.handle(c, ev)
+	}
+}
+
+// whileStarting handles the event during the restart, it reports false for
+// evStarted, which ends it. The events which change the container wait the
+// start, the others are refused, except Info which gets the snapshot.
+func (p *masterProcess) whileStarting(c *Container, ev event) bool {
+	switch ev.action {
+	case evStarted:
+		return false
+
+	case evInfo:
+		info := *p.snapshot
+		ev.reply(&info)
+
+	case evStop:
+		ev.reply(nil)
+		p.deferred = append(p.deferred, ev)
+
+	case evChild, evOOM, evHealth:
+		p.deferred = append(p.deferred, ev)
+
+	default:
+		ev.reply(fmt.Errorf("Container %s is restarting", c.Name))
+	}
+	return true
+}
+
+// finish stops the master after the init process exited for good.
+func (p *masterProcess) finish() {
+	p.restarting = false
+	close(p.stop)
+	log.Println("Stop master process")
+}
+
+// exitState records how the init process exited into container, and
+// returns the exit code of tinybox.
+func (p *masterProcess) exitState(c *Container) int {
+	state := &ExitState{
+		FinishedAt: time.Now(),
+	}
+	c.Exit = state
+
+	if p.cmd.ProcessState == nil {
+		state.Code = 255
+		return state.Code
+	}
+
+	ws := p.cmd.ProcessState.Sys().(syscall.WaitStatus)
+	state.Code = ExitCode(ws)
+	if ws.Signaled() {
+		state.Signal = ws.Signal().String()
+		if ws.Signal() == syscall.SIGKILL {
+			state.OOMKilled = oomKillCount(c.cgop.Paths()[subsysMEM]) > p.oomKills ||
+				p.oom.count() > p.oomEvents
+		}
+	}
+
+	// The events after the event loop exited are counted too.
+	if n := int(p.oom.count()); n > c.OOMEvents {
+		c.OOMEvents = n
+	}
+
+	log.Printf("Init process: %d exit with %d, signal: %q, oom killed: %v \n",
+		c.Pid, state.Code, state.Signal, state.OOMKilled)
+
+	return state.Code
+}
+
 func (p *masterProcess) cleanup(c *Container) {
 	c.fsop.Unmount(c)
+	p.oom.Close()
 
 	if err := os.Remove(c.PipeFile()); err != nil {
-		log.Printf("Remove pipe %s error: %v \n", err)
+		log.Printf("Remove pipe %s error: %v \n", c.PipeFile(), err)
 	}
 
 	for _, path := range c.cgop.Paths() {
@@ -211,6 +685,12 @@ func (p *masterProcess) cleanup(c *Container) {
 			}
 		}
 	}
+
+	if c.Hooks != nil {
+		if err := runHooks(c, "poststop", c.Hooks.Poststop, hookStopped); err != nil {
+			log.Println(err)
+		}
+	}
 }
 
 func (p *masterProcess) cgroup(c *Container) error {
@@ -226,29 +706,109 @@ func (p *masterProcess) cgroup(c *Container) error {
 	if err := c.cgop.CPU(c); err != nil {
 		return err
 	}
+	if err := c.cgop.Freezer(c); err != nil {
+		return err
+	}
+	if err := c.cgop.Pids(c); err != nil {
+		return err
+	}
+	if err := c.cgop.Blkio(c); err != nil {
+		return err
+	}
 	return nil
 }
 
+// stopContainer sends the stop signal to init process, and kills all the
+// processes of container if it's still alive after the stop timeout. A
+// second stop during the timeout kills them immediately.
+func (p *masterProcess) stopContainer(c *Container) {
+	if p.restarting {
+		log.Printf("Cancel restarting container: %s \n", c.Name)
+		p.stopping = true
+		p.finish()
+		return
+	}
+	if p.stopping {
+		p.killAll(c)
+		return
+	}
+	p.stopping = true
+
+	sig, err := ParseSignal(c.StopSignal)
+	if err != nil {
+		log.Println(err)
+		sig = syscall.SIGTERM
+	}
+
+	log.Printf("Stop init process: %d with %s, timeout %ds \n", c.Pid, sig, c.StopTimeout)
+	syscall.Kill(c.Pid, sig)
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		select {
+		case <-time.After(time.Duration(c.StopTimeout) * time.Second):
+			p.killAll(c)
+		case <-p.stop:
+		}
+	}()
+}
+
+// killAll sends SIGKILL to every process in the cgroups of container.
+func (p *masterProcess) killAll(c *Container) {
+	log.Printf("Kill all processes of container: %s \n", c.Name)
+
+	syscall.Kill(c.Pid, syscall.SIGKILL)
+
+	for _, path := range c.cgop.Paths() {
+		pids, err := CgroupProcs(path)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		for _, pid := range pids {
+			syscall.Kill(pid, syscall.SIGKILL)
+		}
+	}
+}
+
 type event struct {
 	action string
 	data   interface{}
 	c      chan interface{}
 }
 
+// reply sends the result of event to the sender, if it waits one.
+func (ev event) reply(v interface{}) {
+	if ev.c == nil {
+		return
+	}
+	select {
+	case ev.c <- v:
+	default:
+	}
+}
+
 // signal function.
 func stopHandle(sig os.Signal, c chan event) {
 	if debug {
 		log.Printf("handle stop \n")
 	}
 
-	ev := event{
-		action: evStop,
-	}
+	sendEvent(c, event{action: evStop})
+}
 
+// forwardHandle sends the signal to the init process of container.
+func forwardHandle(sig os.Signal, c chan event) {
+	sendEvent(c, event{action: evSignal, data: sig})
+}
+
+func sendEvent(c chan event, ev event) {
 	select {
 	case c <- ev:
 	case <-time.After(time.Second * 5):
-		log.Printf("Send event timeout: %ss \n", 5)
+		log.Printf("Send event timeout: %ds \n", 5)
 	}
 }
 
@@ -260,7 +820,6 @@ func (p *masterProcess) signals() {
 	}
 
 	sc := make(chan os.Signal, 10)
-	signal.Ignore(syscall.SIGHUP)
 	signal.Notify(sc, slice...)
 
 	for {
@@ -290,20 +849,127 @@ func (p *masterProcess) events(c *Container) {
 
 		log.Printf("Receive event: %s \n", ev.action)
 
-		switch ev.action {
-		case evStop:
-			log.Printf("Kill init process: %d \n", c.Pid)
-			syscall.Kill(c.Pid, syscall.SIGKILL)
+		if p.starting && p.whileStarting(c, ev) {
+			continue
+		}
+		p.handle(c, ev)
+	}
+}
+
+// handle handles an event of the event loop.
+func (p *masterProcess) handle(c *Container, ev event) {
+	switch ev.action {
+	case evStop:
+		ev.reply(nil)
+		p.stopContainer(c)
+
+	case evSignal:
+		if p.restarting {
+			ev.reply(fmt.Errorf("Container %s is restarting", c.Name))
+			break
+		}
+		sig := ev.data.(os.Signal)
+		if sig == syscall.SIGWINCH && c.Tty {
+			// The console resizes the terminal, kernel sends SIGWINCH.
+			ev.reply(nil)
+			break
+		}
+		log.Printf("Forward signal %s to init process: %d \n", sig, c.Pid)
+		ev.reply(syscall.Kill(c.Pid, sig.(syscall.Signal)))
+
+	case evInfo:
+		info := *c
+		info.Restarting = p.restarting
+		ev.reply(&info)
+
+	case evPause:
+		ev.reply(freeze(c.cgop.Paths()[subsysFZ], freezerFrozen))
+
+	case evResume:
+		ev.reply(freeze(c.cgop.Paths()[subsysFZ], freezerThawed))
+
+	case evStats:
+		ev.reply(readStats(c.cgop.Paths()))
+
+	case evExec:
+		// Don't block the event loop until the exec process exits. The
+		// goroutine has a copy of container, which is changed by restart.
+		go func(ev event, args *ExecArgs, c Container) {
+			timeout := time.Duration(args.Timeout) * time.Second
+			if timeout <= 0 {
+				timeout = time.Duration(math.MaxInt64)
+			}
+			code, output, err := runExec(&c, args.Args, timeout)
+			if err != nil {
+				ev.reply(err)
+				return
+			}
+			ev.reply(&ExecReply{Code: code, Output: output})
+		}(ev, ev.data.(*ExecArgs), *c)
+
+	case evUpdate:
+		opt := ev.data.(*CGroupOptions)
+		if err := p.update(c, opt); err != nil {
+			ev.reply(err)
+			break
+		}
+		ev.reply(opt)
+
+	case evHealth:
+		p.health(c, ev.data.(*HealthResult))
+
+	case evOOM:
+		c.OOMEvents += int(ev.data.(uint64))
+		log.Printf("OOM in container %s at %s, %d in total \n",
+			c.Name, time.Now().Format(time.RFC3339Nano), c.OOMEvents)
+		if err := c.save(); err != nil {
+			log.Println(err)
+		}
+
+	case evChild:
+		p.exited(c)
+
+	case evRestart:
+		if !p.restarting {
+			break
+		}
+		p.restarting = false
+		p.restart(c)
 
-		case evChild:
+	case evStarted:
+		err, _ := ev.data.(error)
+		p.started(c, err)
 
-		default:
-			if ev.c != nil {
-				select {
-				case ev.c <- "hello, world":
-				default:
-				}
+	default:
+		ev.reply(fmt.Errorf("Unknown event: %s", ev.action))
+	}
+}
+
+// update validates the cgroup options and writes them into the cgroups of
+// container, the options are saved into container.json. The limits are
+// rolled back if any of the writes fails.
+func (p *masterProcess) update(c *Container, opt *CGroupOptions) error {
+	for _, setter := range setters {
+		if err := setter.Validate(opt); err != nil {
+			return err
+		}
+	}
+
+	paths := c.cgop.Paths()
+	saved := readLimits(paths)
+	for _, typ := range subs {
+		dir, ok := paths[typ]
+		if !ok {
+			continue
+		}
+		if err := setters.Write(typ, dir, opt); err != nil {
+			if e := restoreLimits(saved); e != nil {
+				log.Printf("Roll back cgroup limits error: %v \n", e)
 			}
+			return fmt.Errorf("Update %s error: %v", typ, err)
 		}
 	}
+
+	c.CgOpts = opt
+	return c.save()
 }
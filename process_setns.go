@@ -1,13 +1,26 @@
 package tinybox
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"syscall"
 )
 
+// execConfig is sent by the master to the setns process through the
+// socketpair, after the setns process reported its pid.
+type execConfig struct {
+	Args    []string `json:"args"`
+	Tty     bool     `json:"tty"`
+	Env     []string `json:"env"`
+	User    string   `json:"user"`    // name, uid, name:group or uid:gid
+	Workdir string   `json:"workdir"` // default is /
+}
+
 type setnsProcess struct {
 }
 
@@ -16,13 +29,22 @@ func setns() *setnsProcess {
 }
 
 func (p *setnsProcess) Start(c *Container) error {
-	cmd := os.Getenv("__TINYBOX_CMD__")
-	if cmd == "" {
+	fd, err := strconv.Atoi(os.Getenv("__TINYBOX_PIPE__"))
+	if err != nil {
 		return nil
 	}
 
+	syscall.CloseOnExec(fd)
+	pipe := os.NewFile(uintptr(fd), "pipe")
+	defer pipe.Close()
+
+	var config execConfig
+	if err := json.NewDecoder(pipe).Decode(&config); err != nil {
+		return fmt.Errorf("Read exec config error: %v", err)
+	}
+
 	if debug {
-		log.Printf("setns command: %s \n", cmd)
+		log.Printf("setns command: %v \n", config.Args)
 	}
 
 	lock, err := Flock(c.LockFile())
@@ -31,15 +53,47 @@ func (p *setnsProcess) Start(c *Container) error {
 	}
 	Funlock(lock)
 
-	argv := strings.Fields(cmd)
-	if len(argv) == 0 {
+	if len(config.Args) == 0 {
 		return nil
 	}
 
-	path, err := exec.LookPath(argv[0])
+	if config.Tty {
+		if err := openConsole(pipe); err != nil {
+			return err
+		}
+	}
+
+	// The command is looked up in the PATH of the exec environment.
+	os.Clearenv()
+	for _, kv := range config.Env {
+		if i := strings.IndexByte(kv, '='); i > 0 {
+			os.Setenv(kv[:i], kv[i+1:])
+		}
+	}
+
+	if config.User != "" {
+		u, err := lookupUser(config.User)
+		if err != nil {
+			return err
+		}
+		if err := u.setUser(); err != nil {
+			return err
+		}
+		if _, ok := os.LookupEnv("HOME"); !ok {
+			os.Setenv("HOME", u.home)
+		}
+	}
+
+	if config.Workdir != "" {
+		if err := os.Chdir(config.Workdir); err != nil {
+			return fmt.Errorf("Change working directory error: %v", err)
+		}
+	}
+
+	path, err := exec.LookPath(config.Args[0])
 	if err != nil {
 		return err
 	}
 
-	return syscall.Exec(path, argv, os.Environ())
+	return syscall.Exec(path, config.Args, os.Environ())
 }
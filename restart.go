@@ -0,0 +1,86 @@
+package tinybox
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The restart policies of container. There's no daemon which starts the
+// containers on boot, so unless-stopped is the same as always.
+const (
+	restartNo            = "no"
+	restartOnFailure     = "on-failure"
+	restartAlways        = "always"
+	restartUnlessStopped = "unless-stopped"
+)
+
+const (
+	restartMinDelay = 100 * time.Millisecond
+	restartMaxDelay = time.Minute
+
+	// An init process which ran longer than it resets the backoff.
+	restartResetAfter = 10 * time.Second
+)
+
+// parseRestart parses a restart policy like "on-failure:3", max is 0 if the
+// restarts are unlimited.
+func parseRestart(s string) (policy string, max int, err error) {
+	policy = s
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		policy = s[:i]
+		if policy != restartOnFailure {
+			return "", 0, fmt.Errorf("Invalid restart policy: %s", s)
+		}
+		if max, err = strconv.Atoi(s[i+1:]); err != nil || max < 0 {
+			return "", 0, fmt.Errorf("Invalid restart policy: %s", s)
+		}
+	}
+
+	switch policy {
+	case restartNo, restartOnFailure, restartAlways, restartUnlessStopped:
+		return policy, max, nil
+	}
+	return "", 0, fmt.Errorf("Invalid restart policy: %s", s)
+}
+
+// shouldRestart reports whether the init process which exited with code is
+// restarted by the restart policy of container.
+func (c *Container) shouldRestart(code int) bool {
+	policy, max, err := parseRestart(c.Restart)
+	if err != nil {
+		return false
+	}
+
+	switch policy {
+	case restartOnFailure:
+		return code != 0 && (max == 0 || c.Restarts < max)
+	case restartAlways, restartUnlessStopped:
+		return true
+	}
+	return false
+}
+
+// restartDelay returns the delay before restarting the init process, which
+// doubles on every restart, false if it isn't restarted.
+func (p *masterProcess) restartDelay(c *Container, code int) (time.Duration, bool) {
+	if p.stopping {
+		return 0, false
+	}
+	if !p.forceRestart && !c.shouldRestart(code) {
+		return 0, false
+	}
+	p.forceRestart = false
+
+	if time.Since(c.StartedAt) > restartResetAfter {
+		p.backoff = 0
+	}
+	if p.backoff *= 2; p.backoff == 0 {
+		p.backoff = restartMinDelay
+	}
+	if p.backoff > restartMaxDelay {
+		p.backoff = restartMaxDelay
+	}
+	return p.backoff, true
+}
@@ -0,0 +1,113 @@
+package tinybox
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRestart(t *testing.T) {
+	tests := []struct {
+		s      string
+		policy string
+		max    int
+		err    bool
+	}{
+		{s: "no", policy: restartNo},
+		{s: "always", policy: restartAlways},
+		{s: "unless-stopped", policy: restartUnlessStopped},
+		{s: "on-failure", policy: restartOnFailure},
+		{s: "on-failure:3", policy: restartOnFailure, max: 3},
+		{s: "on-failure:0", policy: restartOnFailure},
+		{s: "on-failure:-1", err: true},
+		{s: "on-failure:", err: true},
+		{s: "on-failure:x", err: true},
+		{s: "always:3", err: true},
+		{s: "", err: true},
+		{s: "sometimes", err: true},
+	}
+
+	for _, tt := range tests {
+		policy, max, err := parseRestart(tt.s)
+		if (err != nil) != tt.err {
+			t.Errorf("parseRestart(%q) error = %v, want error %v", tt.s, err, tt.err)
+			continue
+		}
+		if policy != tt.policy || max != tt.max {
+			t.Errorf("parseRestart(%q) = %q, %d, want %q, %d", tt.s, policy, max, tt.policy, tt.max)
+		}
+	}
+}
+
+func TestShouldRestart(t *testing.T) {
+	tests := []struct {
+		restart  string
+		restarts int
+		code     int
+		want     bool
+	}{
+		{restart: "no", code: 1, want: false},
+		{restart: "always", code: 0, want: true},
+		{restart: "unless-stopped", code: 0, want: true},
+		{restart: "on-failure", code: 0, want: false},
+		{restart: "on-failure", code: 1, restarts: 100, want: true},
+		{restart: "on-failure:2", code: 1, restarts: 1, want: true},
+		{restart: "on-failure:2", code: 1, restarts: 2, want: false},
+	}
+
+	for _, tt := range tests {
+		c := &Container{Restart: tt.restart, Restarts: tt.restarts}
+		if got := c.shouldRestart(tt.code); got != tt.want {
+			t.Errorf("%s with %d restarts, exit %d: shouldRestart = %v, want %v",
+				tt.restart, tt.restarts, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestRestartDelay(t *testing.T) {
+	p := &masterProcess{}
+	c := &Container{Restart: restartAlways, StartedAt: time.Now()}
+
+	// Doubles on every restart, up to the max.
+	want := restartMinDelay
+	for i := 0; i < 20; i++ {
+		delay, ok := p.restartDelay(c, 1)
+		if !ok {
+			t.Fatalf("restart %d: not restarted", i)
+		}
+		if delay != want {
+			t.Fatalf("restart %d: delay = %s, want %s", i, delay, want)
+		}
+		if want *= 2; want > restartMaxDelay {
+			want = restartMaxDelay
+		}
+	}
+
+	// Reset after a stable run.
+	c.StartedAt = time.Now().Add(-restartResetAfter - time.Second)
+	if delay, _ := p.restartDelay(c, 1); delay != restartMinDelay {
+		t.Errorf("delay after a stable run = %s, want %s", delay, restartMinDelay)
+	}
+
+	// A stopped container isn't restarted.
+	p.stopping = true
+	if _, ok := p.restartDelay(c, 1); ok {
+		t.Errorf("restarted after stop")
+	}
+}
+
+func TestRestartDelayPolicy(t *testing.T) {
+	p := &masterProcess{}
+	c := &Container{Restart: restartNo, StartedAt: time.Now()}
+	if _, ok := p.restartDelay(c, 1); ok {
+		t.Errorf("restarted with policy no")
+	}
+
+	// Forced once, like by an unhealthy container, regardless of the policy.
+	p.forceRestart = true
+	if _, ok := p.restartDelay(c, 0); !ok {
+		t.Errorf("forced restart not restarted")
+	}
+	if _, ok := p.restartDelay(c, 0); ok {
+		t.Errorf("forced restart not reset")
+	}
+}
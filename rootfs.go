@@ -22,10 +22,25 @@ func (fs *rootFs) Mount(c *Container) error {
 		return err
 	}
 
+	// A new devpts instance for the terminal of container.
+	if c.Tty && c.Rootfs != "" {
+		pts := path.Join(c.Rootfs, "dev", "pts")
+		if err := MkdirIfNotExist(pts); err != nil {
+			return err
+		}
+		if err := syscall.Mount("devpts", pts, "devpts", syscall.MS_NOSUID|syscall.MS_NOEXEC,
+			"newinstance,ptmxmode=0666,mode=0620"); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 func (fs *rootFs) Unmount(c *Container) error {
+	if c.Rootfs == "" {
+		return nil
+	}
 	syscall.Unmount(path.Join(c.Rootfs, "proc"), 0)
 	return nil
 }
@@ -0,0 +1,4 @@
+package tinybox
+
+// The syscall package has no SYS_SETNS on 386.
+const sysSetns = 346
@@ -0,0 +1,132 @@
+package tinybox
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stats is the resource usage of container, read from its cgroup files.
+type Stats struct {
+	Time             time.Time         `json:"time"`
+	CpuUsage         uint64            `json:"cpuusage"` // nanoseconds, cpuacct.usage
+	CpuPeriods       uint64            `json:"cpuperiods"`
+	CpuThrottled     uint64            `json:"cputhrottled"`     // periods
+	CpuThrottledTime uint64            `json:"cputhrottledtime"` // nanoseconds
+	MemoryUsage      uint64            `json:"memoryusage"`
+	MemoryLimit      uint64            `json:"memorylimit"`
+	MemoryFailcnt    uint64            `json:"memoryfailcnt"`
+	MemoryStat       map[string]uint64 `json:"memorystat,omitempty"` // memory.stat
+	Pids             int               `json:"pids"`
+	IoReadBytes      uint64            `json:"ioreadbytes"`
+	IoWriteBytes     uint64            `json:"iowritebytes"`
+	IoReadOps        uint64            `json:"ioreadops"`
+	IoWriteOps       uint64            `json:"iowriteops"`
+}
+
+// readStats reads the stats from the cgroup paths of container, a subsystem
+// which isn't joined or a file which can't be read leaves its fields zero.
+func readStats(paths map[string]string) *Stats {
+	s := &Stats{Time: time.Now()}
+
+	if dir := paths[subsysCA]; dir != "" {
+		s.CpuUsage, _ = readUint(filepath.Join(dir, "cpuacct.usage"))
+		if pids, err := CgroupProcs(dir); err == nil {
+			s.Pids = len(pids)
+		}
+	}
+
+	if dir := paths[subsysCPU]; dir != "" {
+		if stat, err := readKeyed(filepath.Join(dir, "cpu.stat")); err == nil {
+			s.CpuPeriods = stat["nr_periods"]
+			s.CpuThrottled = stat["nr_throttled"]
+			s.CpuThrottledTime = stat["throttled_time"]
+		}
+	}
+
+	if dir := paths[subsysMEM]; dir != "" {
+		s.MemoryUsage, _ = readUint(filepath.Join(dir, "memory.usage_in_bytes"))
+		s.MemoryLimit, _ = readUint(filepath.Join(dir, "memory.limit_in_bytes"))
+		s.MemoryFailcnt, _ = readUint(filepath.Join(dir, "memory.failcnt"))
+		s.MemoryStat, _ = readKeyed(filepath.Join(dir, "memory.stat"))
+	}
+
+	// pids.current counts the threads too.
+	if dir := paths[subsysPID]; dir != "" {
+		if n, err := readUint(filepath.Join(dir, "pids.current")); err == nil {
+			s.Pids = int(n)
+		}
+	}
+
+	if dir := paths[subsysBIO]; dir != "" {
+		s.IoReadBytes, s.IoWriteBytes, _ = readBlkio(filepath.Join(dir, "blkio.throttle.io_service_bytes"))
+		s.IoReadOps, s.IoWriteOps, _ = readBlkio(filepath.Join(dir, "blkio.throttle.io_serviced"))
+	}
+
+	return s
+}
+
+// readUint reads a file which has a single unsigned integer.
+func readUint(file string) (uint64, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(string(bytes.TrimSpace(b)), 10, 64)
+}
+
+// readKeyed reads a file of "key value" lines, like cpu.stat.
+func readKeyed(file string) (map[string]uint64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := make(map[string]uint64)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			m[fields[0]] = v
+		}
+	}
+	return m, sc.Err()
+}
+
+// readBlkio sums the Read and Write counters of all devices in a blkio file,
+// whose lines are like "8:0 Read 4096".
+func readBlkio(file string) (read, write uint64, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[1] {
+		case "Read":
+			read += v
+		case "Write":
+			write += v
+		}
+	}
+	return read, write, sc.Err()
+}
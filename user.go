@@ -0,0 +1,143 @@
+package tinybox
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// execUser is the user which the exec process runs as.
+type execUser struct {
+	uid    int
+	gid    int
+	groups []int
+	home   string
+}
+
+// lookupUser resolves a user like name, uid, name:group or uid:gid by the
+// /etc/passwd and /etc/group of container. A uid which isn't in passwd is
+// used with gid 0, like docker does.
+func lookupUser(spec string) (*execUser, error) {
+	name, group := spec, ""
+	if i := strings.IndexByte(spec, ':'); i >= 0 {
+		name, group = spec[:i], spec[i+1:]
+	}
+
+	u := &execUser{home: "/"}
+	found := false
+	err := readColonFile("/etc/passwd", func(fields []string) bool {
+		// name:password:uid:gid:gecos:home:shell
+		if len(fields) < 7 || (fields[0] != name && fields[2] != name) {
+			return false
+		}
+		u.uid, _ = strconv.Atoi(fields[2])
+		u.gid, _ = strconv.Atoi(fields[3])
+		u.home = fields[5]
+		name, found = fields[0], true
+		return true
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if !found {
+		if u.uid, err = strconv.Atoi(name); err != nil || u.uid < 0 {
+			return nil, fmt.Errorf("No such user: %s", name)
+		}
+	}
+
+	if group != "" {
+		gid, err := lookupGroup(group)
+		if err != nil {
+			return nil, err
+		}
+		u.gid = gid
+		return u, nil
+	}
+
+	// The supplementary groups of a named user.
+	if found {
+		err = readColonFile("/etc/group", func(fields []string) bool {
+			// name:password:gid:members
+			if len(fields) < 4 {
+				return false
+			}
+			for _, member := range strings.Split(fields[3], ",") {
+				if member == name {
+					if gid, err := strconv.Atoi(fields[2]); err == nil {
+						u.groups = append(u.groups, gid)
+					}
+				}
+			}
+			return false
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+// lookupGroup resolves a group name or gid by the /etc/group of container.
+func lookupGroup(group string) (int, error) {
+	gid := -1
+	err := readColonFile("/etc/group", func(fields []string) bool {
+		if len(fields) < 3 || fields[0] != group {
+			return false
+		}
+		gid, _ = strconv.Atoi(fields[2])
+		return true
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	if gid >= 0 {
+		return gid, nil
+	}
+	if gid, err = strconv.Atoi(group); err != nil || gid < 0 {
+		return 0, fmt.Errorf("No such group: %s", group)
+	}
+	return gid, nil
+}
+
+// readColonFile calls fn with the fields of each line in a file like
+// /etc/passwd, until fn returns true.
+func readColonFile(file string, fn func([]string) bool) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if fn(strings.Split(line, ":")) {
+			break
+		}
+	}
+	return scanner.Err()
+}
+
+// setUser switches the credentials of process to the user.
+func (u *execUser) setUser() error {
+	groups := u.groups
+	if groups == nil {
+		groups = []int{}
+	}
+	if err := syscall.Setgroups(groups); err != nil {
+		return fmt.Errorf("Set groups error: %v", err)
+	}
+	if err := syscall.Setgid(u.gid); err != nil {
+		return fmt.Errorf("Set gid error: %v", err)
+	}
+	if err := syscall.Setuid(u.uid); err != nil {
+		return fmt.Errorf("Set uid error: %v", err)
+	}
+	return nil
+}